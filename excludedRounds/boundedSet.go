@@ -0,0 +1,215 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package excludedRounds
+
+import (
+	"container/heap"
+	"container/list"
+	"sync"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// EvictionPolicy selects which round a BoundedSet evicts when it is full.
+type EvictionPolicy uint8
+
+const (
+	// EvictLeastRecentlyInserted evicts the round that was inserted the
+	// longest time ago.
+	EvictLeastRecentlyInserted EvictionPolicy = iota
+
+	// EvictLowestRound evicts the round with the lowest ID.
+	EvictLowestRound
+)
+
+// String returns a human-readable name of the EvictionPolicy. This function
+// adheres to the fmt.Stringer interface.
+func (p EvictionPolicy) String() string {
+	switch p {
+	case EvictLeastRecentlyInserted:
+		return "EvictLeastRecentlyInserted"
+	case EvictLowestRound:
+		return "EvictLowestRound"
+	default:
+		return "INVALID EVICTION POLICY"
+	}
+}
+
+// EvictionCallback is called with each round evicted from a BoundedSet to make
+// room for a new round. It is not called for rounds deleted with Remove.
+type EvictionCallback func(rid id.Round)
+
+// BoundedSet is a set of rounds to be excluded from cmix that holds at most a
+// fixed number of rounds. When a round is inserted into a full set, a round is
+// evicted according to the EvictionPolicy. It is safe for concurrent use.
+type BoundedSet struct {
+	capacity int
+	policy   EvictionPolicy
+	onEvict  EvictionCallback
+
+	// For EvictLeastRecentlyInserted, each round maps to its element in the
+	// insertion order list. For EvictLowestRound, the elements are nil and
+	// the rounds are kept in a min-heap, which may contain removed rounds.
+	rounds map[id.Round]*list.Element
+	order  *list.List
+	lowest roundHeap
+
+	events notifier
+	mux    sync.RWMutex
+}
+
+// BoundedSet adheres to the ExcludedRounds and Observable interfaces.
+var (
+	_ ExcludedRounds = (*BoundedSet)(nil)
+	_ Observable     = (*BoundedSet)(nil)
+)
+
+// NewBoundedSet returns a new empty BoundedSet that holds at most capacity
+// rounds, which is at least 1. If onEvict is not nil, it is called with each
+// evicted round after the set is unlocked, so it may call into the set.
+func NewBoundedSet(capacity int, policy EvictionPolicy,
+	onEvict EvictionCallback) *BoundedSet {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return &BoundedSet{
+		capacity: capacity,
+		policy:   policy,
+		onEvict:  onEvict,
+		rounds:   make(map[id.Round]*list.Element, capacity),
+		order:    list.New(),
+	}
+}
+
+// Has indicates if the round is in the set.
+func (bs *BoundedSet) Has(rid id.Round) bool {
+	bs.mux.RLock()
+	defer bs.mux.RUnlock()
+
+	_, exists := bs.rounds[rid]
+	return exists
+}
+
+// Insert adds the round to the set, evicting a round if the set is full.
+// Returns true if the round was added and false if it was already in the set.
+// With EvictLowestRound, a round lower than every round in a full set is not
+// added and false is returned.
+func (bs *BoundedSet) Insert(rid id.Round) bool {
+	bs.mux.Lock()
+
+	if _, exists := bs.rounds[rid]; exists {
+		bs.mux.Unlock()
+		return false
+	}
+
+	var evicted []id.Round
+	added := true
+	switch bs.policy {
+	case EvictLowestRound:
+		if len(bs.rounds) >= bs.capacity && rid < bs.min() {
+			added = false
+			break
+		}
+		bs.rounds[rid] = nil
+		heap.Push(&bs.lowest, rid)
+		for len(bs.rounds) > bs.capacity {
+			evicted = append(evicted, bs.popLowest())
+		}
+	default:
+		bs.rounds[rid] = bs.order.PushBack(rid)
+		for len(bs.rounds) > bs.capacity {
+			oldest := bs.order.Remove(bs.order.Front()).(id.Round)
+			delete(bs.rounds, oldest)
+			evicted = append(evicted, oldest)
+		}
+	}
+
+	if added {
+		bs.events.notify(Inserted, rid, rid)
+	}
+	for _, e := range evicted {
+		bs.events.notify(Removed, e, e)
+	}
+
+	bs.mux.Unlock()
+
+	if bs.onEvict != nil {
+		for _, e := range evicted {
+			bs.onEvict(e)
+		}
+	}
+
+	return added
+}
+
+// Remove deletes the round from the set.
+func (bs *BoundedSet) Remove(rid id.Round) {
+	bs.mux.Lock()
+	defer bs.mux.Unlock()
+
+	elem, exists := bs.rounds[rid]
+	if !exists {
+		return
+	}
+
+	delete(bs.rounds, rid)
+	if elem != nil {
+		bs.order.Remove(elem)
+	}
+	bs.events.notify(Removed, rid, rid)
+
+	// Discard removed rounds from the heap once they make up most of it
+	if len(bs.lowest) > 2*len(bs.rounds)+64 {
+		bs.lowest = bs.lowest[:0]
+		for r := range bs.rounds {
+			bs.lowest = append(bs.lowest, r)
+		}
+		heap.Init(&bs.lowest)
+	}
+}
+
+// Len returns the number of rounds in the set.
+func (bs *BoundedSet) Len() int {
+	bs.mux.RLock()
+	defer bs.mux.RUnlock()
+
+	return len(bs.rounds)
+}
+
+// Subscribe returns a new Subscription that receives an Event for every round
+// inserted into, removed from, or evicted from the set. The buffer is the size
+// of the event channel.
+func (bs *BoundedSet) Subscribe(buffer int) *Subscription {
+	return bs.events.subscribe(buffer)
+}
+
+// Cap returns the maximum number of rounds the set can hold.
+func (bs *BoundedSet) Cap() int {
+	return bs.capacity
+}
+
+// min returns the lowest round in the set, discarding removed rounds from the
+// top of the heap. The set must not be empty.
+func (bs *BoundedSet) min() id.Round {
+	for {
+		if _, exists := bs.rounds[bs.lowest[0]]; exists {
+			return bs.lowest[0]
+		}
+		heap.Pop(&bs.lowest)
+	}
+}
+
+// popLowest removes and returns the lowest round in the set. The set must not
+// be empty.
+func (bs *BoundedSet) popLowest() id.Round {
+	rid := bs.min()
+	heap.Pop(&bs.lowest)
+	delete(bs.rounds, rid)
+	return rid
+}
@@ -0,0 +1,186 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package excludedRounds
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Tests that a BoundedSet with EvictLeastRecentlyInserted evicts rounds in the
+// order they were inserted and calls the eviction callback for each.
+func TestBoundedSet_EvictLeastRecentlyInserted(t *testing.T) {
+	var evicted []id.Round
+	bs := NewBoundedSet(3, EvictLeastRecentlyInserted, func(rid id.Round) {
+		evicted = append(evicted, rid)
+	})
+
+	for _, rid := range []id.Round{50, 10, 30} {
+		if !bs.Insert(rid) {
+			t.Errorf("Failed to insert round %d.", rid)
+		}
+	}
+	if bs.Insert(10) {
+		t.Errorf("Insert did not fail for already inserted round.")
+	}
+
+	bs.Remove(10)
+	bs.Insert(20)
+	bs.Insert(40)
+	bs.Insert(5)
+
+	expected := []id.Round{50, 30}
+	if !reflect.DeepEqual(expected, evicted) {
+		t.Errorf("Unexpected evicted rounds.\nexpected: %v\nreceived: %v",
+			expected, evicted)
+	}
+
+	for rid, has := range map[id.Round]bool{
+		5: true, 10: false, 20: true, 30: false, 40: true, 50: false} {
+		if bs.Has(rid) != has {
+			t.Errorf("Unexpected state for round %d.\nexpected: %t"+
+				"\nreceived: %t", rid, has, bs.Has(rid))
+		}
+	}
+
+	if bs.Len() != 3 || bs.Cap() != 3 {
+		t.Errorf("Unexpected length or capacity: %d, %d", bs.Len(), bs.Cap())
+	}
+}
+
+// Tests that a BoundedSet with EvictLowestRound evicts the lowest rounds and
+// refuses rounds lower than every round in a full set.
+func TestBoundedSet_EvictLowestRound(t *testing.T) {
+	var evicted []id.Round
+	bs := NewBoundedSet(3, EvictLowestRound, func(rid id.Round) {
+		evicted = append(evicted, rid)
+	})
+
+	for _, rid := range []id.Round{50, 10, 30} {
+		bs.Insert(rid)
+	}
+
+	bs.Remove(10)
+	bs.Insert(20)
+	bs.Insert(40)
+	if bs.Insert(5) {
+		t.Errorf("Inserted round %d lower than every round in a full set.", 5)
+	}
+	bs.Insert(60)
+
+	expected := []id.Round{20, 30}
+	if !reflect.DeepEqual(expected, evicted) {
+		t.Errorf("Unexpected evicted rounds.\nexpected: %v\nreceived: %v",
+			expected, evicted)
+	}
+
+	for rid, has := range map[id.Round]bool{
+		5: false, 20: false, 30: false, 40: true, 50: true, 60: true} {
+		if bs.Has(rid) != has {
+			t.Errorf("Unexpected state for round %d.\nexpected: %t"+
+				"\nreceived: %t", rid, has, bs.Has(rid))
+		}
+	}
+}
+
+// Tests that the eviction callback of a BoundedSet can call into the set.
+func TestBoundedSet_EvictionCallbackReentrant(t *testing.T) {
+	var bs *BoundedSet
+	bs = NewBoundedSet(1, EvictLeastRecentlyInserted, func(rid id.Round) {
+		if bs.Has(rid) {
+			t.Errorf("Evicted round %d still in set.", rid)
+		}
+	})
+
+	bs.Insert(1)
+	bs.Insert(2)
+}
+
+// Tests that the heap of a BoundedSet with EvictLowestRound does not grow
+// without bound when rounds are repeatedly removed and re-inserted.
+func TestBoundedSet_Remove_StaleEntries(t *testing.T) {
+	bs := NewBoundedSet(10, EvictLowestRound, nil)
+	for i := 0; i < 10000; i++ {
+		bs.Insert(7)
+		bs.Remove(7)
+	}
+
+	if bs.Len() != 0 || len(bs.lowest) > 100 {
+		t.Errorf("Unexpected length %d and heap size %d.",
+			bs.Len(), len(bs.lowest))
+	}
+}
+
+// Tests that a BoundedSet never exceeds its capacity when used concurrently.
+func TestBoundedSet_Concurrent(t *testing.T) {
+	for _, policy := range []EvictionPolicy{
+		EvictLeastRecentlyInserted, EvictLowestRound} {
+		var evictions int
+		var mux sync.Mutex
+		bs := NewBoundedSet(100, policy, func(id.Round) {
+			mux.Lock()
+			evictions++
+			mux.Unlock()
+		})
+
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 1000; i++ {
+					rid := id.Round(i*8 + g)
+					bs.Insert(rid)
+					bs.Has(rid)
+					if i%5 == 0 {
+						bs.Remove(rid)
+					}
+					if bs.Len() > bs.Cap() {
+						t.Errorf("Length %d larger than capacity %d (%s).",
+							bs.Len(), bs.Cap(), policy)
+					}
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		if bs.Len() > bs.Cap() || evictions == 0 {
+			t.Errorf("Unexpected length %d and evictions %d (%s).",
+				bs.Len(), evictions, policy)
+		}
+	}
+}
+
+// Tests that BoundedSet sends a Removed event for each evicted round after the
+// Inserted event of the round that caused the eviction.
+func TestBoundedSet_Subscribe(t *testing.T) {
+	bs := NewBoundedSet(2, EvictLowestRound, nil)
+	sub := bs.Subscribe(10)
+
+	bs.Insert(20)
+	bs.Insert(10)
+	bs.Insert(30)
+	bs.Insert(5)
+	bs.Remove(20)
+	sub.Unsubscribe()
+
+	var received []Event
+	for e := range sub.Events() {
+		received = append(received, e)
+	}
+
+	expected := []Event{{Inserted, 20, 20}, {Inserted, 10, 10},
+		{Inserted, 30, 30}, {Removed, 10, 10}, {Removed, 20, 20}}
+	if !reflect.DeepEqual(expected, received) {
+		t.Errorf("Unexpected events.\nexpected: %v\nreceived: %v",
+			expected, received)
+	}
+}
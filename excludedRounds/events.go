@@ -0,0 +1,138 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package excludedRounds
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// EventType describes how the rounds in an Event changed.
+type EventType uint8
+
+// List of event types.
+const (
+	// Inserted is used when rounds are excluded.
+	Inserted EventType = iota
+
+	// Removed is used when rounds are no longer excluded, either because they
+	// were removed or because they were evicted or expired.
+	Removed
+)
+
+// String returns the string representation of the EventType. This function
+// adheres to the fmt.Stringer interface.
+func (t EventType) String() string {
+	switch t {
+	case Inserted:
+		return "INSERTED"
+	case Removed:
+		return "REMOVED"
+	default:
+		return "UNKNOWN EVENT TYPE: " + strconv.FormatUint(uint64(t), 10)
+	}
+}
+
+// Event describes a change to the rounds in a set. It covers the rounds from
+// Start to End, inclusive. Sets that change one round at a time send events
+// where Start and End are the same round. Every round covered by an event
+// changed; rounds that were already in the set or already absent are never
+// included.
+type Event struct {
+	Type  EventType
+	Start id.Round
+	End   id.Round
+}
+
+// Observable is implemented by sets that send an Event on every change.
+type Observable interface {
+	// Subscribe returns a new Subscription that receives every change made
+	// to the set after it is created.
+	Subscribe(buffer int) *Subscription
+}
+
+// Subscription receives the events of a set over a channel. Events are sent
+// without blocking: when the channel buffer is full, the event is dropped and
+// counted so that a slow subscriber cannot stall changes to the set.
+type Subscription struct {
+	events  chan Event
+	dropped atomic.Uint64
+	n       *notifier
+	once    sync.Once
+}
+
+// Events returns the channel events are received on. The channel is closed
+// when the Subscription is unsubscribed.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped returns the number of events dropped because the channel buffer was
+// full.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Unsubscribe stops sending events to the Subscription and closes its
+// channel. Events already in the channel can still be received. It is safe to
+// call more than once.
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(func() {
+		s.n.mux.Lock()
+		defer s.n.mux.Unlock()
+
+		delete(s.n.subs, s)
+		close(s.events)
+	})
+}
+
+// notifier sends events to the subscriptions of a set. The zero value is ready
+// to use. Sets call notify while holding their own lock so that events are
+// received in the order the changes were made.
+type notifier struct {
+	subs map[*Subscription]struct{}
+	mux  sync.RWMutex
+}
+
+// subscribe returns a new Subscription with a channel of the given buffer
+// size, which is at least 1.
+func (n *notifier) subscribe(buffer int) *Subscription {
+	if buffer < 1 {
+		buffer = 1
+	}
+
+	s := &Subscription{events: make(chan Event, buffer), n: n}
+
+	n.mux.Lock()
+	defer n.mux.Unlock()
+
+	if n.subs == nil {
+		n.subs = make(map[*Subscription]struct{})
+	}
+	n.subs[s] = struct{}{}
+
+	return s
+}
+
+// notify sends an event for the rounds from start to end, inclusive, to every
+// subscription without blocking.
+func (n *notifier) notify(t EventType, start, end id.Round) {
+	n.mux.RLock()
+	defer n.mux.RUnlock()
+
+	for s := range n.subs {
+		select {
+		case s.events <- Event{Type: t, Start: start, End: end}:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package excludedRounds
+
+import (
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Tests that a Subscription receives events for every change in order, that
+// no events are sent for changes that do nothing, and that its channel is
+// closed on Unsubscribe.
+func TestSubscription(t *testing.T) {
+	s := NewSet()
+	sub := s.Subscribe(10)
+
+	s.Insert(5)
+	s.Insert(5)
+	s.Insert(6)
+	s.Remove(5)
+	s.Remove(7)
+
+	sub.Unsubscribe()
+	sub.Unsubscribe()
+	s.Insert(8)
+
+	var received []Event
+	for e := range sub.Events() {
+		received = append(received, e)
+	}
+
+	expected := []Event{{Inserted, 5, 5}, {Inserted, 6, 6}, {Removed, 5, 5}}
+	if !reflect.DeepEqual(expected, received) {
+		t.Errorf("Unexpected events.\nexpected: %v\nreceived: %v",
+			expected, received)
+	}
+}
+
+// Tests that events are dropped and counted instead of blocking when a
+// Subscription's channel is full and that other subscriptions are unaffected.
+func TestSubscription_Dropped(t *testing.T) {
+	s := NewSet()
+	slow := s.Subscribe(2)
+	fast := s.Subscribe(10)
+
+	for rid := id.Round(0); rid < 5; rid++ {
+		s.Insert(rid)
+	}
+
+	if slow.Dropped() != 3 || len(slow.Events()) != 2 {
+		t.Errorf("Unexpected dropped and buffered events.\nexpected: %d, %d"+
+			"\nreceived: %d, %d", 3, 2, slow.Dropped(), len(slow.Events()))
+	}
+	if fast.Dropped() != 0 || len(fast.Events()) != 5 {
+		t.Errorf("Unexpected dropped and buffered events.\nexpected: %d, %d"+
+			"\nreceived: %d, %d", 0, 5, fast.Dropped(), len(fast.Events()))
+	}
+}
+
+// Tests that subscriptions to each Observable set can replay the events they
+// receive to reconstruct the set when changes, subscriptions, and
+// unsubscriptions happen concurrently.
+func TestSubscription_Concurrent(t *testing.T) {
+	sets := map[string]interface {
+		ExcludedRounds
+		Observable
+	}{
+		"Set":         NewSet(),
+		"RangeSet":    NewRangeSet(),
+		"MetadataSet": NewMetadataSet(),
+		"BoundedSet":  NewBoundedSet(1000, EvictLeastRecentlyInserted, nil),
+		"ExpiringSet": NewExpiringSet(0, 0),
+	}
+
+	for name, set := range sets {
+		set := set
+		t.Run(name, func(t *testing.T) {
+			const workers, changes = 8, 500
+			sub := set.Subscribe(2 * workers * changes)
+
+			// Subscriptions that come and go must not disturb the others
+			done, stopped := make(chan struct{}), make(chan struct{})
+			go func() {
+				defer close(stopped)
+				for {
+					select {
+					case <-done:
+						return
+					default:
+						set.Subscribe(1).Unsubscribe()
+					}
+				}
+			}()
+
+			var wg sync.WaitGroup
+			for w := 0; w < workers; w++ {
+				wg.Add(1)
+				go func(seed int64) {
+					defer wg.Done()
+					prng := rand.New(rand.NewSource(seed))
+					for i := 0; i < changes; i++ {
+						rid := id.Round(prng.Intn(200))
+						if prng.Intn(2) == 0 {
+							set.Insert(rid)
+						} else {
+							set.Remove(rid)
+						}
+					}
+				}(int64(w))
+			}
+			wg.Wait()
+			close(done)
+			<-stopped
+			sub.Unsubscribe()
+
+			if sub.Dropped() != 0 {
+				t.Fatalf("Dropped %d events.", sub.Dropped())
+			}
+
+			replayed := make(map[id.Round]bool)
+			for e := range sub.Events() {
+				for rid := e.Start; rid <= e.End; rid++ {
+					if replayed[rid] == (e.Type == Inserted) {
+						t.Fatalf("Event %v does not change round %d.", e, rid)
+					}
+					replayed[rid] = e.Type == Inserted
+				}
+			}
+
+			for rid := id.Round(0); rid < 200; rid++ {
+				if replayed[rid] != set.Has(rid) {
+					t.Errorf("Unexpected replayed state for round %d."+
+						"\nexpected: %t\nreceived: %t",
+						rid, set.Has(rid), replayed[rid])
+				}
+			}
+		})
+	}
+}
+
+// Tests that EventType.String returns the expected string for each type.
+func TestEventType_String(t *testing.T) {
+	tests := map[EventType]string{
+		Inserted: "INSERTED",
+		Removed:  "REMOVED",
+		7:        "UNKNOWN EVENT TYPE: 7",
+	}
+
+	for et, expected := range tests {
+		if et.String() != expected {
+			t.Errorf("Unexpected string for event type %d."+
+				"\nexpected: %s\nreceived: %s", uint8(et), expected, et.String())
+		}
+	}
+}
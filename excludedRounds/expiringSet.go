@@ -0,0 +1,233 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package excludedRounds
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// ExpiringSet is a set of rounds to be excluded from cmix where each round is
+// only kept for a limited time. A round expires when its time-to-live has
+// elapsed or when it is more than the maximum round age older than the newest
+// round inserted. Expired rounds are evicted lazily on each call. It is safe
+// for concurrent use.
+type ExpiringSet struct {
+	rounds      map[id.Round]time.Time // Expiry time of each round
+	expiries    expiryHeap
+	order       roundHeap
+	ttl         time.Duration
+	maxRoundAge uint64
+	newest      id.Round
+	now         func() time.Time
+	events      notifier
+	mux         sync.Mutex
+}
+
+// ExpiringSet adheres to the ExcludedRounds and Observable interfaces.
+var (
+	_ ExcludedRounds = (*ExpiringSet)(nil)
+	_ Observable     = (*ExpiringSet)(nil)
+)
+
+// NewExpiringSet returns a new empty ExpiringSet. Rounds inserted with Insert
+// expire after the given time-to-live. Rounds also expire when they are more
+// than maxRoundAge rounds older than the newest inserted round. A ttl or
+// maxRoundAge of zero disables that limit.
+func NewExpiringSet(ttl time.Duration, maxRoundAge uint64) *ExpiringSet {
+	return NewExpiringSetWithClock(ttl, maxRoundAge, time.Now)
+}
+
+// NewExpiringSetWithClock returns a new empty ExpiringSet like NewExpiringSet
+// that gets the current time from now. This allows tests to control time.
+func NewExpiringSetWithClock(ttl time.Duration, maxRoundAge uint64,
+	now func() time.Time) *ExpiringSet {
+	return &ExpiringSet{
+		rounds:      make(map[id.Round]time.Time),
+		ttl:         ttl,
+		maxRoundAge: maxRoundAge,
+		now:         now,
+	}
+}
+
+// Has indicates if the round is in the set and has not expired.
+func (es *ExpiringSet) Has(rid id.Round) bool {
+	es.mux.Lock()
+	defer es.mux.Unlock()
+
+	es.evict()
+	_, exists := es.rounds[rid]
+	return exists
+}
+
+// Insert adds the round to the set with the default time-to-live. Returns true
+// if the round was added and false if it is already in the set or is already
+// too old to be kept. The expiry of a round already in the set is not changed.
+func (es *ExpiringSet) Insert(rid id.Round) bool {
+	return es.InsertWithTTL(rid, es.ttl)
+}
+
+// InsertWithTTL adds the round to the set with the given time-to-live. A ttl of
+// zero means the round does not expire with time. Returns true if the round
+// was added and false if it is already in the set or is already too old to be
+// kept.
+func (es *ExpiringSet) InsertWithTTL(rid id.Round, ttl time.Duration) bool {
+	es.mux.Lock()
+	defer es.mux.Unlock()
+
+	es.evict()
+	if _, exists := es.rounds[rid]; exists || es.tooOld(rid) {
+		return false
+	}
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = es.now().Add(ttl)
+		heap.Push(&es.expiries, expiry{rid: rid, expires: expires})
+	}
+	es.rounds[rid] = expires
+	es.events.notify(Inserted, rid, rid)
+
+	if es.maxRoundAge > 0 {
+		heap.Push(&es.order, rid)
+	}
+
+	if rid > es.newest {
+		es.newest = rid
+		es.evict()
+	}
+
+	return true
+}
+
+// Remove deletes the round from the set.
+func (es *ExpiringSet) Remove(rid id.Round) {
+	es.mux.Lock()
+	defer es.mux.Unlock()
+
+	if _, exists := es.rounds[rid]; exists {
+		delete(es.rounds, rid)
+		es.events.notify(Removed, rid, rid)
+	}
+	es.evict()
+}
+
+// Len returns the number of rounds in the set that have not expired.
+func (es *ExpiringSet) Len() int {
+	es.mux.Lock()
+	defer es.mux.Unlock()
+
+	es.evict()
+	return len(es.rounds)
+}
+
+// Subscribe returns a new Subscription that receives an Event for every round
+// inserted into or removed from the set. Expired rounds send a Removed event
+// when they are evicted, which happens lazily on the next call to the set. The
+// buffer is the size of the event channel.
+func (es *ExpiringSet) Subscribe(buffer int) *Subscription {
+	return es.events.subscribe(buffer)
+}
+
+// Evict removes all expired rounds and returns the number of rounds remaining.
+// Expired rounds are evicted on every call, so calling Evict is only needed to
+// release memory when the set is not otherwise used.
+func (es *ExpiringSet) Evict() int {
+	return es.Len()
+}
+
+// tooOld determines if the round is older than the maximum round age relative
+// to the newest round.
+func (es *ExpiringSet) tooOld(rid id.Round) bool {
+	return es.maxRoundAge > 0 && rid < es.newest &&
+		uint64(es.newest-rid) > es.maxRoundAge
+}
+
+// evict removes every round whose time-to-live has elapsed or that is too old.
+// Heap entries for rounds that were removed or re-inserted are discarded.
+func (es *ExpiringSet) evict() {
+	if len(es.expiries) > 0 {
+		now := es.now()
+		for len(es.expiries) > 0 && !es.expiries[0].expires.After(now) {
+			e := heap.Pop(&es.expiries).(expiry)
+			if expires, exists := es.rounds[e.rid]; exists &&
+				expires.Equal(e.expires) {
+				delete(es.rounds, e.rid)
+				es.events.notify(Removed, e.rid, e.rid)
+			}
+		}
+	}
+
+	for len(es.order) > 0 && es.tooOld(es.order[0]) {
+		rid := heap.Pop(&es.order).(id.Round)
+		if _, exists := es.rounds[rid]; exists {
+			delete(es.rounds, rid)
+			es.events.notify(Removed, rid, rid)
+		}
+	}
+
+	// Discard stale heap entries once they make up most of the heaps
+	if len(es.expiries) > 2*len(es.rounds)+64 || len(es.order) > 2*len(es.rounds)+64 {
+		es.rebuild()
+	}
+}
+
+// rebuild recreates the heaps from the rounds in the set.
+func (es *ExpiringSet) rebuild() {
+	es.expiries = es.expiries[:0]
+	es.order = es.order[:0]
+	for rid, expires := range es.rounds {
+		if !expires.IsZero() {
+			es.expiries = append(es.expiries, expiry{rid: rid, expires: expires})
+		}
+		if es.maxRoundAge > 0 {
+			es.order = append(es.order, rid)
+		}
+	}
+	heap.Init(&es.expiries)
+	heap.Init(&es.order)
+}
+
+// expiry is the time a round expires.
+type expiry struct {
+	rid     id.Round
+	expires time.Time
+}
+
+// expiryHeap is a min-heap of expiries ordered by time. It adheres to the
+// heap.Interface interface.
+type expiryHeap []expiry
+
+func (h expiryHeap) Len() int            { return len(h) }
+func (h expiryHeap) Less(i, j int) bool  { return h[i].expires.Before(h[j].expires) }
+func (h expiryHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x interface{}) { *h = append(*h, x.(expiry)) }
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// roundHeap is a min-heap of round IDs. It adheres to the heap.Interface
+// interface.
+type roundHeap []id.Round
+
+func (h roundHeap) Len() int            { return len(h) }
+func (h roundHeap) Less(i, j int) bool  { return h[i] < h[j] }
+func (h roundHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *roundHeap) Push(x interface{}) { *h = append(*h, x.(id.Round)) }
+func (h *roundHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
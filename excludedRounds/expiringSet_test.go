@@ -0,0 +1,206 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package excludedRounds
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// testClock is a clock for tests that only moves when advanced.
+type testClock struct {
+	t   time.Time
+	mux sync.Mutex
+}
+
+func newTestClock() *testClock {
+	return &testClock{t: time.Unix(1700000000, 0)}
+}
+
+func (c *testClock) Now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.t
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// Tests that rounds in an ExpiringSet expire after their time-to-live.
+func TestExpiringSet_TTL(t *testing.T) {
+	clock := newTestClock()
+	es := NewExpiringSetWithClock(time.Hour, 0, clock.Now)
+
+	if !es.Insert(1) || !es.InsertWithTTL(2, 3*time.Hour) ||
+		!es.InsertWithTTL(3, 0) {
+		t.Fatalf("Failed to insert rounds.")
+	}
+	if es.Insert(1) {
+		t.Errorf("Insert did not fail for already inserted round.")
+	}
+	if es.Len() != 3 {
+		t.Errorf("Unexpected length.\nexpected: %d\nreceived: %d", 3, es.Len())
+	}
+
+	clock.Advance(time.Hour - time.Second)
+	if !es.Has(1) {
+		t.Errorf("Round %d expired before its time-to-live.", 1)
+	}
+
+	clock.Advance(time.Second)
+	if es.Has(1) {
+		t.Errorf("Round %d did not expire after its time-to-live.", 1)
+	}
+	if es.Len() != 2 {
+		t.Errorf("Unexpected length.\nexpected: %d\nreceived: %d", 2, es.Len())
+	}
+
+	clock.Advance(2 * time.Hour)
+	if es.Has(2) || !es.Has(3) {
+		t.Errorf("Unexpected rounds after %s: has 2: %t, has 3: %t",
+			3*time.Hour, es.Has(2), es.Has(3))
+	}
+
+	// An expired round can be inserted again
+	if !es.Insert(1) || !es.Has(1) {
+		t.Errorf("Failed to insert expired round %d again.", 1)
+	}
+}
+
+// Tests that rounds in an ExpiringSet expire when they are older than the
+// maximum round age relative to the newest round.
+func TestExpiringSet_MaxRoundAge(t *testing.T) {
+	es := NewExpiringSetWithClock(0, 100, newTestClock().Now)
+
+	for _, rid := range []id.Round{10, 50, 100} {
+		es.Insert(rid)
+	}
+	if es.Len() != 3 {
+		t.Errorf("Unexpected length.\nexpected: %d\nreceived: %d", 3, es.Len())
+	}
+
+	es.Insert(150)
+	if es.Has(10) || !es.Has(50) || !es.Has(150) {
+		t.Errorf("Unexpected rounds after inserting %d: %v", 150, es.rounds)
+	}
+
+	if es.Insert(20) {
+		t.Errorf("Inserted round %d older than the maximum age.", 20)
+	}
+
+	es.Insert(1000)
+	if es.Len() != 1 {
+		t.Errorf("Unexpected length.\nexpected: %d\nreceived: %d", 1, es.Len())
+	}
+}
+
+// Tests that removing and re-inserting a round in an ExpiringSet uses the new
+// expiry instead of the old one.
+func TestExpiringSet_Remove_Reinsert(t *testing.T) {
+	clock := newTestClock()
+	es := NewExpiringSetWithClock(time.Hour, 0, clock.Now)
+
+	es.Insert(5)
+	clock.Advance(30 * time.Minute)
+	es.Remove(5)
+	if es.Has(5) || es.Len() != 0 {
+		t.Errorf("Round %d not removed.", 5)
+	}
+
+	es.Insert(5)
+	clock.Advance(45 * time.Minute)
+	if !es.Has(5) {
+		t.Errorf("Re-inserted round %d expired with its old expiry.", 5)
+	}
+
+	clock.Advance(15 * time.Minute)
+	if es.Has(5) {
+		t.Errorf("Re-inserted round %d did not expire.", 5)
+	}
+}
+
+// Tests that the heaps of an ExpiringSet do not grow without bound when rounds
+// are repeatedly removed and re-inserted.
+func TestExpiringSet_Evict_StaleEntries(t *testing.T) {
+	es := NewExpiringSetWithClock(time.Hour, 1<<20, newTestClock().Now)
+
+	for i := 0; i < 10000; i++ {
+		es.Insert(7)
+		es.Remove(7)
+	}
+
+	if es.Evict() != 0 {
+		t.Errorf("Unexpected length.\nexpected: %d\nreceived: %d", 0, es.Len())
+	}
+	if len(es.expiries) > 100 || len(es.order) > 100 {
+		t.Errorf("Heaps not cleaned: %d expiries, %d rounds.",
+			len(es.expiries), len(es.order))
+	}
+}
+
+// Tests that an ExpiringSet can be used concurrently.
+func TestExpiringSet_Concurrent(t *testing.T) {
+	clock := newTestClock()
+	es := NewExpiringSetWithClock(time.Minute, 500, clock.Now)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				rid := id.Round(g*1000 + i)
+				es.Insert(rid)
+				es.Has(rid)
+				if i%3 == 0 {
+					es.Remove(rid)
+				}
+				if i%100 == 0 {
+					clock.Advance(time.Second)
+				}
+				es.Len()
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+// Tests that ExpiringSet sends a Removed event for each round when it expires
+// or becomes too old.
+func TestExpiringSet_Subscribe(t *testing.T) {
+	clock := newTestClock()
+	es := NewExpiringSetWithClock(time.Minute, 100, clock.Now)
+	sub := es.Subscribe(10)
+
+	es.Insert(10)
+	es.InsertWithTTL(20, 0)
+	clock.Advance(2 * time.Minute)
+	es.Insert(150)
+	es.Remove(150)
+	sub.Unsubscribe()
+
+	var received []Event
+	for e := range sub.Events() {
+		received = append(received, e)
+	}
+
+	expected := []Event{{Inserted, 10, 10}, {Inserted, 20, 20},
+		{Removed, 10, 10}, {Inserted, 150, 150}, {Removed, 20, 20},
+		{Removed, 150, 150}}
+	if !reflect.DeepEqual(expected, received) {
+		t.Errorf("Unexpected events.\nexpected: %v\nreceived: %v",
+			expected, received)
+	}
+}
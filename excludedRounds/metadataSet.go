@@ -0,0 +1,199 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package excludedRounds
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Reason describes why a round was excluded.
+type Reason uint16
+
+// List of exclusion reasons.
+const (
+	// ReasonUnspecified is used for rounds inserted without a reason.
+	ReasonUnspecified Reason = iota
+
+	// ReasonRoundFailed is used for rounds that failed.
+	ReasonRoundFailed
+
+	// ReasonTimeout is used for rounds that timed out.
+	ReasonTimeout
+
+	// ReasonGatewayError is used for rounds whose gateway returned an error.
+	ReasonGatewayError
+
+	// ReasonManual is used for rounds excluded by an operator.
+	ReasonManual
+)
+
+// String returns the string representation of the Reason. This function
+// adheres to the fmt.Stringer interface.
+func (r Reason) String() string {
+	switch r {
+	case ReasonUnspecified:
+		return "UNSPECIFIED"
+	case ReasonRoundFailed:
+		return "ROUND FAILED"
+	case ReasonTimeout:
+		return "TIMEOUT"
+	case ReasonGatewayError:
+		return "GATEWAY ERROR"
+	case ReasonManual:
+		return "MANUAL"
+	default:
+		return "UNKNOWN REASON: " + strconv.FormatUint(uint64(r), 10)
+	}
+}
+
+// Exclusion describes why and when a round was excluded.
+type Exclusion struct {
+	Round  id.Round
+	Reason Reason
+	Time   time.Time
+
+	// Source is the ID of the gateway that caused the exclusion. It is nil if
+	// the source is unknown.
+	Source *id.ID
+}
+
+// MetadataSet is a set of rounds to be excluded from cmix that records the
+// reason, time, and source of each exclusion. It is safe for concurrent use.
+type MetadataSet struct {
+	rounds map[id.Round]Exclusion
+	now    func() time.Time
+	events notifier
+	mux    sync.RWMutex
+}
+
+// MetadataSet adheres to the ExcludedRounds and Observable interfaces.
+var (
+	_ ExcludedRounds = (*MetadataSet)(nil)
+	_ Observable     = (*MetadataSet)(nil)
+)
+
+// NewMetadataSet returns a new empty MetadataSet.
+func NewMetadataSet() *MetadataSet {
+	return NewMetadataSetWithClock(time.Now)
+}
+
+// NewMetadataSetWithClock returns a new empty MetadataSet like NewMetadataSet
+// that gets the time of each exclusion from now. This allows tests to control
+// time.
+func NewMetadataSetWithClock(now func() time.Time) *MetadataSet {
+	return &MetadataSet{
+		rounds: make(map[id.Round]Exclusion),
+		now:    now,
+	}
+}
+
+// Has indicates if the round is in the set.
+func (ms *MetadataSet) Has(rid id.Round) bool {
+	ms.mux.RLock()
+	defer ms.mux.RUnlock()
+
+	_, exists := ms.rounds[rid]
+	return exists
+}
+
+// Insert adds the round to the set with ReasonUnspecified and no source.
+// Returns true if the round was added and false if it was already in the set.
+func (ms *MetadataSet) Insert(rid id.Round) bool {
+	return ms.InsertWithReason(rid, ReasonUnspecified, nil)
+}
+
+// InsertWithReason adds the round to the set with the given reason and source
+// gateway ID, which may be nil. Returns true if the round was added and false
+// if it was already in the set, in which case its metadata is not changed.
+func (ms *MetadataSet) InsertWithReason(
+	rid id.Round, reason Reason, source *id.ID) bool {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+
+	if _, exists := ms.rounds[rid]; exists {
+		return false
+	}
+
+	ms.rounds[rid] = Exclusion{
+		Round:  rid,
+		Reason: reason,
+		Time:   ms.now(),
+		Source: copySource(source),
+	}
+	ms.events.notify(Inserted, rid, rid)
+	return true
+}
+
+// Remove deletes the round from the set.
+func (ms *MetadataSet) Remove(rid id.Round) {
+	ms.mux.Lock()
+	defer ms.mux.Unlock()
+
+	if _, exists := ms.rounds[rid]; exists {
+		delete(ms.rounds, rid)
+		ms.events.notify(Removed, rid, rid)
+	}
+}
+
+// Len returns the number of rounds in the set.
+func (ms *MetadataSet) Len() int {
+	ms.mux.RLock()
+	defer ms.mux.RUnlock()
+
+	return len(ms.rounds)
+}
+
+// Subscribe returns a new Subscription that receives an Event for every round
+// inserted into or removed from the set. The buffer is the size of the event
+// channel.
+func (ms *MetadataSet) Subscribe(buffer int) *Subscription {
+	return ms.events.subscribe(buffer)
+}
+
+// Get returns the Exclusion for the round. Returns false if the round is not
+// in the set.
+func (ms *MetadataSet) Get(rid id.Round) (Exclusion, bool) {
+	ms.mux.RLock()
+	defer ms.mux.RUnlock()
+
+	e, exists := ms.rounds[rid]
+	if !exists {
+		return Exclusion{}, false
+	}
+
+	e.Source = copySource(e.Source)
+	return e, true
+}
+
+// List returns the Exclusion of every round in the set sorted by round.
+func (ms *MetadataSet) List() []Exclusion {
+	ms.mux.RLock()
+	defer ms.mux.RUnlock()
+
+	list := make([]Exclusion, 0, len(ms.rounds))
+	for _, e := range ms.rounds {
+		e.Source = copySource(e.Source)
+		list = append(list, e)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Round < list[j].Round })
+	return list
+}
+
+// copySource returns a copy of the source gateway ID or nil if it is nil.
+func copySource(source *id.ID) *id.ID {
+	if source == nil {
+		return nil
+	}
+	return source.DeepCopy()
+}
@@ -0,0 +1,110 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package excludedRounds
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Tests that MetadataSet.Get returns the reason, time, and source of each
+// exclusion and that they are not changed by a repeated insert.
+func TestMetadataSet_Get(t *testing.T) {
+	clock := newTestClock()
+	ms := NewMetadataSetWithClock(clock.Now)
+	gwID := id.NewIdFromString("gateway", id.Gateway, t)
+
+	if !ms.InsertWithReason(5, ReasonGatewayError, gwID) {
+		t.Errorf("Failed to insert round %d.", 5)
+	}
+	insertTime := clock.Now()
+	clock.Advance(time.Minute)
+	if !ms.Insert(6) {
+		t.Errorf("Failed to insert round %d.", 6)
+	}
+	if ms.InsertWithReason(5, ReasonManual, nil) {
+		t.Errorf("InsertWithReason did not fail for already inserted round.")
+	}
+
+	// Modifying the ID after insertion must not modify the stored source
+	gwID[0]++
+
+	e, exists := ms.Get(5)
+	if !exists {
+		t.Fatalf("Failed to get round %d.", 5)
+	}
+	expected := Exclusion{
+		Round:  5,
+		Reason: ReasonGatewayError,
+		Time:   insertTime,
+		Source: id.NewIdFromString("gateway", id.Gateway, t),
+	}
+	if !reflect.DeepEqual(expected, e) {
+		t.Errorf("Unexpected exclusion.\nexpected: %+v\nreceived: %+v",
+			expected, e)
+	}
+
+	e, exists = ms.Get(6)
+	if !exists || e.Reason != ReasonUnspecified || e.Source != nil {
+		t.Errorf("Unexpected exclusion for round %d: %+v", 6, e)
+	}
+
+	if _, exists = ms.Get(7); exists {
+		t.Errorf("Got exclusion for round %d that was never inserted.", 7)
+	}
+}
+
+// Tests that MetadataSet.List returns every exclusion sorted by round and that
+// removed rounds are not listed.
+func TestMetadataSet_List(t *testing.T) {
+	ms := NewMetadataSet()
+	for _, rid := range []id.Round{30, 10, 50, 20, 40} {
+		ms.InsertWithReason(rid, ReasonTimeout, nil)
+	}
+	ms.Remove(20)
+
+	var rounds []id.Round
+	for _, e := range ms.List() {
+		if e.Reason != ReasonTimeout || e.Time.IsZero() {
+			t.Errorf("Unexpected exclusion for round %d: %+v", e.Round, e)
+		}
+		rounds = append(rounds, e.Round)
+	}
+
+	expected := []id.Round{10, 30, 40, 50}
+	if !reflect.DeepEqual(expected, rounds) {
+		t.Errorf("Unexpected rounds.\nexpected: %v\nreceived: %v",
+			expected, rounds)
+	}
+
+	if ms.Has(20) || !ms.Has(30) || ms.Len() != 4 {
+		t.Errorf("Unexpected state after Remove: %d rounds", ms.Len())
+	}
+}
+
+// Tests that Reason.String returns the expected string for each reason.
+func TestReason_String(t *testing.T) {
+	tests := map[Reason]string{
+		ReasonUnspecified:  "UNSPECIFIED",
+		ReasonRoundFailed:  "ROUND FAILED",
+		ReasonTimeout:      "TIMEOUT",
+		ReasonGatewayError: "GATEWAY ERROR",
+		ReasonManual:       "MANUAL",
+		100:                "UNKNOWN REASON: 100",
+	}
+
+	for r, expected := range tests {
+		if r.String() != expected {
+			t.Errorf("Unexpected string for reason %d."+
+				"\nexpected: %s\nreceived: %s", uint16(r), expected, r.String())
+		}
+	}
+}
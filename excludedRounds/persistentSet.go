@@ -0,0 +1,508 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package excludedRounds
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Minimum number of journal records a PersistentSet writes before compacting
+// the journal into a full save. The journal is compacted once it holds more
+// records than this plus the number of rounds in the set, which keeps the cost
+// of each change constant on average.
+const minCompactJournalLen = 64
+
+// Operations stored in PersistentSet journal records.
+const (
+	journalInsert byte = iota + 1
+	journalRemove
+)
+
+// Encoding version of the data a PersistentSet saves to Storage, which is the
+// sequence number of the last change it includes followed by the marshalled
+// Set.
+const persistentSetVersion = 1
+
+// Storage saves and loads the marshalled rounds of a PersistentSet.
+type Storage interface {
+	// Load returns the most recently saved data or nil if nothing has been
+	// saved.
+	Load() ([]byte, error)
+
+	// Save replaces the saved data. If an error is returned, the data may or
+	// may not have been saved.
+	Save(data []byte) error
+}
+
+// JournalStorage is a Storage that can also append records to a journal, so
+// that a PersistentSet can save each change without saving the whole set.
+type JournalStorage interface {
+	Storage
+
+	// Append durably adds a record to the end of the journal. If an error is
+	// returned, the record should not be returned by LoadJournal, though it
+	// may be if it could not be removed.
+	Append(record []byte) error
+
+	// LoadJournal returns, in order, the records appended since the last
+	// call to Save. A record left incomplete by an interrupted Append is
+	// discarded. Records appended before the last call to Save may also be
+	// returned if clearing the journal was interrupted.
+	LoadJournal() ([][]byte, error)
+}
+
+// PersistentSet is a Set that saves its rounds to Storage on every insert and
+// removal, so that excluded rounds are remembered across restarts. If the
+// Storage is a JournalStorage, then each change is appended to the journal and
+// the whole set is only saved once the journal grows larger than the set;
+// otherwise, each change saves the whole set. A change is saved before it is
+// applied, so a change that fails to save is not applied. It is safe for
+// concurrent use.
+//
+// Every change is given a sequence number, which is stored in its journal
+// record, and the saved set stores the sequence number of the last change it
+// includes. When loading, journal records that are already included in the
+// saved set are skipped, so records left in the journal after a save are never
+// applied over newer data.
+type PersistentSet struct {
+	set        *Set
+	storage    Storage
+	journal    JournalStorage // Nil if storage does not support journaling
+	journalLen int            // Number of records in the journal
+	seq        uint64         // Sequence number of the last saved change
+
+	// True when a failed save may have left the Storage out of sync with the
+	// set, so the whole set must be saved on the next change
+	needsSave bool
+
+	mux sync.Mutex // Serialises changes so saves are in order
+}
+
+// PersistentSet adheres to the ExcludedRounds and Observable interfaces.
+var (
+	_ ExcludedRounds = (*PersistentSet)(nil)
+	_ Observable     = (*PersistentSet)(nil)
+)
+
+// NewPersistentSet returns a PersistentSet that saves to the given Storage. If
+// the Storage contains saved rounds, they are loaded into the set along with
+// any changes in its journal. An error is returned if loading fails or the
+// saved data is corrupt.
+func NewPersistentSet(storage Storage) (*PersistentSet, error) {
+	ps := &PersistentSet{set: NewSet(), storage: storage}
+
+	data, err := storage.Load()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load excluded rounds")
+	} else if data != nil {
+		if ps.seq, err = ps.unmarshal(data); err != nil {
+			return nil, errors.Wrap(err, "failed to load excluded rounds")
+		}
+	}
+
+	if js, ok := storage.(JournalStorage); ok {
+		ps.journal = js
+
+		records, err := js.LoadJournal()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load excluded rounds journal")
+		}
+
+		for i, record := range records {
+			op, seq, rid, err := unmarshalJournalRecord(record)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to load excluded "+
+					"rounds journal record %d", i)
+			}
+
+			// Skip records already included in the saved data
+			if seq <= ps.seq {
+				continue
+			} else if seq != ps.seq+1 {
+				// The records after a gap cannot be applied in order; save
+				// the whole set on the next change to clear them
+				jww.WARN.Printf("Discarding excluded rounds journal from "+
+					"record %d: record %d does not follow record %d",
+					i, seq, ps.seq)
+				ps.needsSave = true
+				break
+			}
+
+			if op == journalInsert {
+				ps.set.Insert(rid)
+			} else {
+				ps.set.Remove(rid)
+			}
+			ps.seq = seq
+		}
+		ps.journalLen = len(records)
+	}
+
+	return ps, nil
+}
+
+// Has indicates if the round is in the set.
+func (ps *PersistentSet) Has(rid id.Round) bool {
+	return ps.set.Has(rid)
+}
+
+// Insert adds the round to the set and saves it. Returns true if the round was
+// added and false if it was already in the set or saving failed, in which case
+// the error is logged and the round is not added. Use TryInsert to get the
+// error.
+func (ps *PersistentSet) Insert(rid id.Round) bool {
+	added, err := ps.TryInsert(rid)
+	if err != nil {
+		jww.ERROR.Printf("Failed to insert excluded round %d: %+v", rid, err)
+	}
+
+	return added
+}
+
+// TryInsert adds the round to the set and saves it. Returns true if the round
+// was added and false if it was already in the set. If saving fails, the round
+// is not added and the error is returned.
+func (ps *PersistentSet) TryInsert(rid id.Round) (bool, error) {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+
+	if ps.set.Has(rid) {
+		return false, nil
+	}
+
+	if err := ps.persist(journalInsert, rid); err != nil {
+		return false, errors.Wrapf(err, "failed to save excluded round %d", rid)
+	}
+
+	ps.set.Insert(rid)
+	return true, nil
+}
+
+// Remove deletes the round from the set and saves the change. If saving fails,
+// the error is logged and the round is not removed. Use TryRemove to get the
+// error.
+func (ps *PersistentSet) Remove(rid id.Round) {
+	if err := ps.TryRemove(rid); err != nil {
+		jww.ERROR.Printf("Failed to remove excluded round %d: %+v", rid, err)
+	}
+}
+
+// TryRemove deletes the round from the set and saves the change. If saving
+// fails, the round is not removed and the error is returned.
+func (ps *PersistentSet) TryRemove(rid id.Round) error {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+
+	if !ps.set.Has(rid) {
+		return nil
+	}
+
+	if err := ps.persist(journalRemove, rid); err != nil {
+		return errors.Wrapf(err, "failed to save removal of excluded round %d",
+			rid)
+	}
+
+	ps.set.Remove(rid)
+	return nil
+}
+
+// Len returns the number of rounds in the set.
+func (ps *PersistentSet) Len() int {
+	return ps.set.Len()
+}
+
+// Subscribe returns a new Subscription that receives an Event for every round
+// inserted into or removed from the set. Rounds loaded from Storage do not send
+// events. The buffer is the size of the event channel.
+func (ps *PersistentSet) Subscribe(buffer int) *Subscription {
+	return ps.set.Subscribe(buffer)
+}
+
+// Save saves all the current rounds to Storage, which clears the journal of a
+// JournalStorage.
+func (ps *PersistentSet) Save() error {
+	ps.mux.Lock()
+	defer ps.mux.Unlock()
+
+	return ps.save(ps.set.list())
+}
+
+// persist saves the insertion or removal of the round, which has not yet been
+// applied to the set, by appending it to the journal or, when the journal is
+// full or not supported, by saving the whole set with the change. The caller
+// must hold the lock.
+func (ps *PersistentSet) persist(op byte, rid id.Round) error {
+	if ps.journal != nil && !ps.needsSave &&
+		ps.journalLen < ps.set.Len()+minCompactJournalLen {
+		record := marshalJournalRecord(op, ps.seq+1, rid)
+		if err := ps.journal.Append(record); err != nil {
+			ps.needsSave = true
+			return errors.Wrap(err, "failed to append to journal")
+		}
+
+		ps.journalLen++
+		ps.seq++
+		return nil
+	}
+
+	rounds := ps.set.list()
+	if op == journalInsert {
+		rounds = append(rounds, rid)
+	} else {
+		for i := range rounds {
+			if rounds[i] == rid {
+				rounds[i] = rounds[len(rounds)-1]
+				rounds = rounds[:len(rounds)-1]
+				break
+			}
+		}
+	}
+
+	return ps.save(rounds)
+}
+
+// save saves the rounds to Storage, replacing any saved rounds and journal,
+// as a new change. The caller must hold the lock.
+func (ps *PersistentSet) save(rounds []id.Round) error {
+	data := binary.AppendUvarint([]byte{persistentSetVersion}, ps.seq+1)
+	data = append(data, marshalRounds(rounds)...)
+	if err := ps.storage.Save(data); err != nil {
+		ps.needsSave = true
+		return err
+	}
+
+	ps.journalLen = 0
+	ps.seq++
+	ps.needsSave = false
+	return nil
+}
+
+// unmarshal decodes the data saved by save into the set and returns the
+// sequence number of the last change it includes.
+func (ps *PersistentSet) unmarshal(data []byte) (uint64, error) {
+	if len(data) == 0 || data[0] != persistentSetVersion {
+		return 0, errors.Wrap(ErrCorruptEncoding,
+			"PersistentSet encoding version unrecognized")
+	}
+
+	seq, n := binary.Uvarint(data[1:])
+	if n <= 0 {
+		return 0, errors.Wrap(ErrCorruptEncoding,
+			"failed to read PersistentSet sequence number")
+	}
+
+	return seq, ps.set.Unmarshal(data[1+n:])
+}
+
+// marshalJournalRecord encodes the operation, sequence number, and round as a
+// journal record.
+func marshalJournalRecord(op byte, seq uint64, rid id.Round) []byte {
+	record := binary.AppendUvarint([]byte{op}, seq)
+	return binary.AppendUvarint(record, uint64(rid))
+}
+
+// unmarshalJournalRecord decodes a journal record produced by
+// marshalJournalRecord.
+func unmarshalJournalRecord(record []byte) (byte, uint64, id.Round, error) {
+	if len(record) < 3 ||
+		(record[0] != journalInsert && record[0] != journalRemove) {
+		return 0, 0, 0, errors.Wrapf(ErrCorruptEncoding,
+			"invalid journal record %v", record)
+	}
+
+	seq, n := binary.Uvarint(record[1:])
+	if n <= 0 {
+		return 0, 0, 0, errors.Wrapf(ErrCorruptEncoding,
+			"invalid sequence number in journal record %v", record)
+	}
+
+	rid, m := binary.Uvarint(record[1+n:])
+	if m <= 0 || 1+n+m != len(record) {
+		return 0, 0, 0, errors.Wrapf(ErrCorruptEncoding,
+			"invalid round in journal record %v", record)
+	}
+
+	return record[0], seq, id.Round(rid), nil
+}
+
+// Size of the header of each record in a FileStorage journal, which contains
+// the record length and checksum.
+const journalHeaderLen = 8
+
+// FileStorage is a JournalStorage that saves to a single file and appends to a
+// journal file next to it. Saves are atomic: the data is written to a
+// temporary file that then replaces the saved file, so a crash during a save
+// leaves the previous data intact.
+//
+// Each journal record is written in the following format:
+// +--------+-------+--------------+
+// | length | crc32 |    record    |
+// | 4 bytes|4 bytes| length bytes |
+// +--------+-------+--------------+
+type FileStorage struct {
+	path string
+	mux  sync.Mutex
+}
+
+// FileStorage adheres to the JournalStorage interface.
+var _ JournalStorage = (*FileStorage)(nil)
+
+// NewFileStorage returns a FileStorage that saves to the file at the given
+// path and appends to the journal at the path with ".journal" appended.
+func NewFileStorage(path string) *FileStorage {
+	return &FileStorage{path: path}
+}
+
+// Load returns the contents of the file or nil if it does not exist.
+func (fs *FileStorage) Load() ([]byte, error) {
+	data, err := os.ReadFile(fs.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return data, nil
+}
+
+// Save atomically replaces the contents of the file with the data and then
+// clears the journal. An error is returned if the journal cannot be cleared,
+// even though the data has been saved.
+func (fs *FileStorage) Save(data []byte) error {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+
+	tmpPath := fs.path + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary file")
+	}
+
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "failed to write temporary file")
+	} else if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "failed to sync temporary file")
+	} else if err = f.Close(); err != nil {
+		return errors.Wrap(err, "failed to close temporary file")
+	}
+
+	if err = os.Rename(tmpPath, fs.path); err != nil {
+		return errors.Wrap(err, "failed to replace file")
+	}
+
+	// Sync the directory so that the rename is durable
+	dir, err := os.Open(filepath.Dir(fs.path))
+	if err != nil {
+		return errors.Wrap(err, "failed to open directory")
+	}
+	defer func() { _ = dir.Close() }()
+
+	if err = dir.Sync(); err != nil {
+		return errors.Wrap(err, "failed to sync directory")
+	}
+
+	err = os.Truncate(fs.journalPath(), 0)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to clear journal")
+	}
+
+	return nil
+}
+
+// Append durably adds the record to the end of the journal file. If writing
+// fails, then the partially written record is removed.
+func (fs *FileStorage) Append(record []byte) error {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+
+	f, err := os.OpenFile(fs.journalPath(), os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to open journal")
+	}
+	defer func() { _ = f.Close() }()
+
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return errors.Wrap(err, "failed to seek journal")
+	}
+
+	data := make([]byte, journalHeaderLen, journalHeaderLen+len(record))
+	binary.LittleEndian.PutUint32(data[:4], uint32(len(record)))
+	binary.LittleEndian.PutUint32(data[4:], crc32.ChecksumIEEE(record))
+	data = append(data, record...)
+
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		if truncErr := f.Truncate(size); truncErr != nil {
+			jww.WARN.Printf("Failed to remove incomplete excluded rounds "+
+				"journal record: %+v", truncErr)
+		}
+		return errors.Wrap(err, "failed to write journal")
+	}
+
+	return nil
+}
+
+// LoadJournal returns the records in the journal file. Reading stops at the
+// first incomplete or corrupt record, which is removed from the file along
+// with everything after it so that new records are not appended after it.
+func (fs *FileStorage) LoadJournal() ([][]byte, error) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+
+	data, err := os.ReadFile(fs.journalPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var records [][]byte
+	offset := 0
+	for len(data)-offset >= journalHeaderLen {
+		n := int(binary.LittleEndian.Uint32(data[offset:]))
+		checksum := binary.LittleEndian.Uint32(data[offset+4:])
+		start := offset + journalHeaderLen
+		if n > len(data)-start ||
+			crc32.ChecksumIEEE(data[start:start+n]) != checksum {
+			break
+		}
+
+		records = append(records, data[start:start+n])
+		offset = start + n
+	}
+
+	if offset < len(data) {
+		jww.WARN.Printf("Discarding excluded rounds journal from offset %d "+
+			"of %d", offset, len(data))
+		if err = os.Truncate(fs.journalPath(), int64(offset)); err != nil {
+			return nil, errors.Wrap(err, "failed to truncate journal")
+		}
+	}
+
+	return records, nil
+}
+
+// journalPath returns the path to the journal file.
+func (fs *FileStorage) journalPath() string {
+	return fs.path + ".journal"
+}
@@ -0,0 +1,416 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package excludedRounds
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Tests that the rounds inserted into and removed from a PersistentSet are
+// restored when it is reopened from the same FileStorage.
+func TestPersistentSet_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "excludedRounds")
+
+	ps, err := NewPersistentSet(NewFileStorage(path))
+	if err != nil {
+		t.Fatalf("Failed to create PersistentSet: %+v", err)
+	}
+	if ps.Len() != 0 {
+		t.Errorf("New PersistentSet is not empty: %d", ps.Len())
+	}
+
+	for rid := id.Round(100); rid < 200; rid++ {
+		ps.Insert(rid)
+	}
+	if ps.Insert(150) {
+		t.Errorf("Insert did not fail for already inserted round.")
+	}
+	for rid := id.Round(100); rid < 200; rid += 3 {
+		ps.Remove(rid)
+	}
+
+	ps, err = NewPersistentSet(NewFileStorage(path))
+	if err != nil {
+		t.Fatalf("Failed to reopen PersistentSet: %+v", err)
+	}
+
+	for rid := id.Round(90); rid < 210; rid++ {
+		expected := rid >= 100 && rid < 200 && (rid-100)%3 != 0
+		if ps.Has(rid) != expected {
+			t.Errorf("Unexpected state for round %d.\nexpected: %t"+
+				"\nreceived: %t", rid, expected, ps.Has(rid))
+		}
+	}
+}
+
+// Tests that a partially written temporary file left by a crash during a save
+// does not affect the saved rounds.
+func TestPersistentSet_TornSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "excludedRounds")
+
+	ps, err := NewPersistentSet(NewFileStorage(path))
+	if err != nil {
+		t.Fatalf("Failed to create PersistentSet: %+v", err)
+	}
+	ps.Insert(5)
+	ps.Insert(6)
+
+	data := ps.set.Marshal()
+	if err = os.WriteFile(path+".tmp", data[:len(data)-1], 0600); err != nil {
+		t.Fatalf("Failed to write temporary file: %+v", err)
+	}
+
+	ps, err = NewPersistentSet(NewFileStorage(path))
+	if err != nil {
+		t.Fatalf("Failed to reopen PersistentSet: %+v", err)
+	}
+	if ps.Len() != 2 || !ps.Has(5) || !ps.Has(6) {
+		t.Errorf("Unexpected rounds after torn save: %v", ps.set.xr)
+	}
+}
+
+// Error path: Tests that NewPersistentSet returns an error wrapping
+// ErrCorruptEncoding when the saved data is corrupt.
+func TestNewPersistentSet_CorruptError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "excludedRounds")
+
+	ps, err := NewPersistentSet(NewFileStorage(path))
+	if err != nil {
+		t.Fatalf("Failed to create PersistentSet: %+v", err)
+	}
+	ps.Insert(5)
+	ps.Insert(600)
+	if err = ps.Save(); err != nil {
+		t.Fatalf("Failed to save PersistentSet: %+v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read file: %+v", err)
+	}
+	if err = os.WriteFile(path, data[:len(data)-1], 0600); err != nil {
+		t.Fatalf("Failed to write file: %+v", err)
+	}
+
+	_, err = NewPersistentSet(NewFileStorage(path))
+	if !errors.Is(err, ErrCorruptEncoding) {
+		t.Errorf("Unexpected error.\nexpected: %v\nreceived: %+v",
+			ErrCorruptEncoding, err)
+	}
+}
+
+// Error path: Tests that a PersistentSet does not apply a change that fails to
+// save, returns the error from TryInsert and TryRemove, and that later changes
+// are saved once the Storage recovers.
+func TestPersistentSet_SaveError(t *testing.T) {
+	storage := &failingStorage{}
+	ps, err := NewPersistentSet(storage)
+	if err != nil {
+		t.Fatalf("Failed to create PersistentSet: %+v", err)
+	}
+	ps.Insert(5)
+
+	storage.fail = true
+	if ps.Insert(7) || ps.Has(7) {
+		t.Errorf("Round %d added after failed save.", 7)
+	}
+	if added, err := ps.TryInsert(7); added || err == nil {
+		t.Errorf("TryInsert did not return an error for a failed save.")
+	}
+	if err = ps.TryRemove(5); err == nil {
+		t.Errorf("TryRemove did not return an error for a failed save.")
+	}
+	ps.Remove(5)
+	if !ps.Has(5) {
+		t.Errorf("Round %d removed after failed save.", 5)
+	}
+	if added, err := ps.TryInsert(5); added || err != nil {
+		t.Errorf("TryInsert of existing round returned %t, %v.", added, err)
+	}
+
+	storage.fail = false
+	if !ps.Insert(7) {
+		t.Errorf("Failed to insert round %d after Storage recovered.", 7)
+	}
+
+	ps, err = NewPersistentSet(storage)
+	if err != nil {
+		t.Fatalf("Failed to reopen PersistentSet: %+v", err)
+	}
+	if !ps.Has(5) || !ps.Has(7) || ps.Len() != 2 {
+		t.Errorf("Unexpected rounds after reopen: %v", ps.set.xr)
+	}
+}
+
+// Tests that a PersistentSet with a FileStorage appends each change to the
+// journal instead of saving the whole set, and compacts the journal into a
+// full save once it holds more records than the set has rounds.
+func TestPersistentSet_Journal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "excludedRounds")
+	ps, err := NewPersistentSet(NewFileStorage(path))
+	if err != nil {
+		t.Fatalf("Failed to create PersistentSet: %+v", err)
+	}
+
+	for rid := id.Round(0); rid < minCompactJournalLen; rid++ {
+		ps.Insert(rid)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Whole set saved before the journal is full: %v", err)
+	}
+	if ps.journalLen != minCompactJournalLen {
+		t.Errorf("Unexpected journal length.\nexpected: %d\nreceived: %d",
+			minCompactJournalLen, ps.journalLen)
+	}
+
+	// With the set this size, the journal is full after this many records
+	for rid := id.Round(0); rid < minCompactJournalLen; rid += 2 {
+		ps.Remove(rid)
+	}
+	for i := 0; i < 100; i++ {
+		ps.Insert(1000)
+		ps.Remove(1000)
+	}
+	if ps.journalLen > ps.Len()+minCompactJournalLen {
+		t.Errorf("Journal of length %d not compacted.", ps.journalLen)
+	}
+	if _, err = os.Stat(path); err != nil {
+		t.Errorf("Whole set not saved after journal compaction: %v", err)
+	}
+
+	expected := ps.set.list()
+	ps, err = NewPersistentSet(NewFileStorage(path))
+	if err != nil {
+		t.Fatalf("Failed to reopen PersistentSet: %+v", err)
+	}
+	if ps.Len() != len(expected) {
+		t.Errorf("Unexpected length.\nexpected: %d\nreceived: %d",
+			len(expected), ps.Len())
+	}
+	for _, rid := range expected {
+		if !ps.Has(rid) {
+			t.Errorf("Round %d not loaded.", rid)
+		}
+	}
+}
+
+// Tests that an incomplete record at the end of the journal, left by a crash
+// during an append, is discarded and that new records are kept.
+func TestPersistentSet_TornJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "excludedRounds")
+	ps, err := NewPersistentSet(NewFileStorage(path))
+	if err != nil {
+		t.Fatalf("Failed to create PersistentSet: %+v", err)
+	}
+	ps.Insert(5)
+	ps.Insert(6)
+
+	journal, err := os.ReadFile(path + ".journal")
+	if err != nil {
+		t.Fatalf("Failed to read journal: %+v", err)
+	}
+	err = os.WriteFile(path+".journal", journal[:len(journal)-1], 0600)
+	if err != nil {
+		t.Fatalf("Failed to write journal: %+v", err)
+	}
+
+	ps, err = NewPersistentSet(NewFileStorage(path))
+	if err != nil {
+		t.Fatalf("Failed to reopen PersistentSet: %+v", err)
+	}
+	if !ps.Has(5) || ps.Has(6) {
+		t.Errorf("Unexpected rounds after torn journal: %v", ps.set.xr)
+	}
+
+	ps.Insert(7)
+	ps, err = NewPersistentSet(NewFileStorage(path))
+	if err != nil {
+		t.Fatalf("Failed to reopen PersistentSet: %+v", err)
+	}
+	if !ps.Has(5) || ps.Has(6) || !ps.Has(7) {
+		t.Errorf("Unexpected rounds after insert: %v", ps.set.xr)
+	}
+}
+
+// Error path: Tests that a PersistentSet does not apply a change that fails to
+// append to the journal and saves the whole set on the next change, so that
+// any data left in the journal by the failure is cleared.
+func TestPersistentSet_AppendError(t *testing.T) {
+	storage := &failingJournalStorage{}
+	ps, err := NewPersistentSet(storage)
+	if err != nil {
+		t.Fatalf("Failed to create PersistentSet: %+v", err)
+	}
+	ps.Insert(5)
+
+	storage.failAppend = true
+	if _, err = ps.TryInsert(6); err == nil || ps.Has(6) {
+		t.Errorf("TryInsert did not fail or added the round: %v", err)
+	}
+
+	// The failed append left its record in the journal
+	if len(storage.journal) != 2 {
+		t.Fatalf("Unexpected journal length: %d", len(storage.journal))
+	}
+
+	storage.failAppend = false
+	if !ps.Insert(7) {
+		t.Errorf("Failed to insert round %d.", 7)
+	}
+	if len(storage.journal) != 0 || storage.data == nil {
+		t.Errorf("Whole set not saved after failed append.")
+	}
+
+	ps, err = NewPersistentSet(storage)
+	if err != nil {
+		t.Fatalf("Failed to reopen PersistentSet: %+v", err)
+	}
+	if !ps.Has(5) || ps.Has(6) || !ps.Has(7) {
+		t.Errorf("Unexpected rounds after reopen: %v", ps.set.xr)
+	}
+}
+
+// Tests that journal records left in the journal after the whole set is saved,
+// as when a crash occurs before the journal is cleared, are not applied over
+// the saved set when it is loaded.
+func TestPersistentSet_StaleJournal(t *testing.T) {
+	storage := &failingJournalStorage{keepJournal: true}
+	ps, err := NewPersistentSet(storage)
+	if err != nil {
+		t.Fatalf("Failed to create PersistentSet: %+v", err)
+	}
+	ps.Insert(5)
+	ps.Remove(5)
+
+	// Fill the journal so that the next change saves the whole set
+	for ps.journalLen < ps.Len()+minCompactJournalLen {
+		if ps.Has(1000) {
+			ps.Remove(1000)
+		} else {
+			ps.Insert(1000)
+		}
+	}
+	ps.Insert(5)
+	if storage.data == nil || len(storage.journal) == 0 {
+		t.Fatalf("Whole set not saved with records left in the journal.")
+	}
+
+	check := func(expected []id.Round) {
+		newPs, err := NewPersistentSet(storage)
+		if err != nil {
+			t.Fatalf("Failed to reopen PersistentSet: %+v", err)
+		}
+		if newPs.Len() != len(expected) {
+			t.Errorf("Unexpected length after reopen."+
+				"\nexpected: %d\nreceived: %d", len(expected), newPs.Len())
+		}
+		for _, rid := range expected {
+			if !newPs.Has(rid) {
+				t.Errorf("Round %d not loaded.", rid)
+			}
+		}
+	}
+	check(ps.set.list())
+
+	// Records appended after the stale records are applied
+	ps.Insert(6)
+	ps.Remove(5)
+	check(ps.set.list())
+}
+
+// Tests that NewPersistentSet stops applying journal records at a gap in their
+// sequence numbers and saves the whole set on the next change.
+func TestPersistentSet_JournalGap(t *testing.T) {
+	storage := &failingJournalStorage{journal: [][]byte{
+		marshalJournalRecord(journalInsert, 1, 5),
+		marshalJournalRecord(journalInsert, 3, 6),
+	}}
+	ps, err := NewPersistentSet(storage)
+	if err != nil {
+		t.Fatalf("Failed to create PersistentSet: %+v", err)
+	}
+	if !ps.Has(5) || ps.Has(6) {
+		t.Errorf("Unexpected rounds after journal gap: %v", ps.set.xr)
+	}
+
+	ps.Insert(7)
+	if len(storage.journal) != 0 || storage.data == nil {
+		t.Errorf("Whole set not saved after journal gap.")
+	}
+}
+
+// Error path: Tests that FileStorage.Save returns an error when the journal
+// cannot be cleared.
+func TestFileStorage_Save_ClearJournalError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "excludedRounds")
+	fs := NewFileStorage(path)
+
+	// A directory cannot be truncated
+	if err := os.Mkdir(fs.journalPath(), 0700); err != nil {
+		t.Fatalf("Failed to create directory: %+v", err)
+	}
+
+	if err := fs.Save([]byte{1, 2, 3}); err == nil {
+		t.Errorf("Save did not return an error when the journal could not " +
+			"be cleared.")
+	}
+}
+
+// failingStorage is an in-memory Storage whose saves can be made to fail.
+type failingStorage struct {
+	data []byte
+	fail bool
+}
+
+func (fs *failingStorage) Load() ([]byte, error) { return fs.data, nil }
+
+func (fs *failingStorage) Save(data []byte) error {
+	if fs.fail {
+		return errors.New("save failed")
+	}
+	fs.data = data
+	return nil
+}
+
+// failingJournalStorage is an in-memory JournalStorage whose appends can be
+// made to fail after writing the record, as when a sync fails, and whose saves
+// can be made to leave the journal in place, as when a crash occurs before the
+// journal is cleared.
+type failingJournalStorage struct {
+	failingStorage
+	journal     [][]byte
+	failAppend  bool
+	keepJournal bool
+}
+
+func (fjs *failingJournalStorage) Save(data []byte) error {
+	if err := fjs.failingStorage.Save(data); err != nil {
+		return err
+	}
+	if !fjs.keepJournal {
+		fjs.journal = nil
+	}
+	return nil
+}
+
+func (fjs *failingJournalStorage) Append(record []byte) error {
+	fjs.journal = append(fjs.journal, record)
+	if fjs.failAppend {
+		return errors.New("append failed")
+	}
+	return nil
+}
+
+func (fjs *failingJournalStorage) LoadJournal() ([][]byte, error) {
+	return fjs.journal, nil
+}
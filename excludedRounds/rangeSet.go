@@ -0,0 +1,250 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package excludedRounds
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Interval is an inclusive span of rounds from Start to End.
+type Interval struct {
+	Start id.Round
+	End   id.Round
+}
+
+// RangeSet is a set of rounds to be excluded from cmix that stores spans of
+// consecutive rounds as intervals. Overlapping and adjacent intervals are
+// merged, so memory scales with the number of spans rather than the number of
+// rounds. It is safe for concurrent use.
+type RangeSet struct {
+	// Sorted, non-overlapping and non-adjacent intervals
+	intervals []Interval
+	events    notifier
+	mux       sync.RWMutex
+}
+
+// RangeSet adheres to the ExcludedRounds and Observable interfaces.
+var (
+	_ ExcludedRounds = (*RangeSet)(nil)
+	_ Observable     = (*RangeSet)(nil)
+)
+
+// NewRangeSet returns a new empty RangeSet.
+func NewRangeSet() *RangeSet {
+	return &RangeSet{}
+}
+
+// Has indicates if the round is in the set.
+func (rs *RangeSet) Has(rid id.Round) bool {
+	return rs.HasAny(rid, rid)
+}
+
+// HasAny indicates if any round between start and end, inclusive, is in the
+// set. Returns false if start is greater than end.
+func (rs *RangeSet) HasAny(start, end id.Round) bool {
+	if start > end {
+		return false
+	}
+
+	rs.mux.RLock()
+	defer rs.mux.RUnlock()
+
+	i := rs.firstEndingAtOrAfter(start)
+	return i < len(rs.intervals) && rs.intervals[i].Start <= end
+}
+
+// Insert adds the round to the set. Returns true if the round was added and
+// false if it was already in the set.
+func (rs *RangeSet) Insert(rid id.Round) bool {
+	return rs.InsertRange(rid, rid)
+}
+
+// InsertRange adds all rounds between start and end, inclusive, to the set.
+// Returns true if any round was added and false if all of them were already in
+// the set or start is greater than end.
+func (rs *RangeSet) InsertRange(start, end id.Round) bool {
+	if start > end {
+		return false
+	}
+
+	rs.mux.Lock()
+	defer rs.mux.Unlock()
+
+	// Find the intervals that overlap or are adjacent to the new interval
+	i := sort.Search(len(rs.intervals), func(k int) bool {
+		return rs.intervals[k].End >= start || rs.intervals[k].End+1 == start
+	})
+	j := sort.Search(len(rs.intervals), func(k int) bool {
+		return rs.intervals[k].Start > end && rs.intervals[k].Start-1 != end
+	})
+
+	if j-i == 1 && rs.intervals[i].Start <= start && rs.intervals[i].End >= end {
+		return false
+	}
+
+	// Send an event for each gap between the existing intervals that is
+	// filled by the new interval
+	next := start
+	covered := false
+	for _, iv := range rs.intervals[i:j] {
+		if iv.Start > next {
+			gapEnd := iv.Start - 1
+			if gapEnd > end {
+				gapEnd = end
+			}
+			rs.events.notify(Inserted, next, gapEnd)
+		}
+		if iv.End >= next {
+			if iv.End >= end {
+				covered = true
+				break
+			}
+			next = iv.End + 1
+		}
+	}
+	if !covered {
+		rs.events.notify(Inserted, next, end)
+	}
+
+	merged := Interval{start, end}
+	if i < j {
+		if rs.intervals[i].Start < merged.Start {
+			merged.Start = rs.intervals[i].Start
+		}
+		if rs.intervals[j-1].End > merged.End {
+			merged.End = rs.intervals[j-1].End
+		}
+	}
+
+	rs.replace(i, j, merged)
+	return true
+}
+
+// Remove deletes the round from the set.
+func (rs *RangeSet) Remove(rid id.Round) {
+	rs.RemoveRange(rid, rid)
+}
+
+// RemoveRange deletes all rounds between start and end, inclusive, from the
+// set. It does nothing if start is greater than end.
+func (rs *RangeSet) RemoveRange(start, end id.Round) {
+	if start > end {
+		return
+	}
+
+	rs.mux.Lock()
+	defer rs.mux.Unlock()
+
+	// Find the intervals that overlap the removed interval
+	i := rs.firstEndingAtOrAfter(start)
+	j := sort.Search(len(rs.intervals), func(k int) bool {
+		return rs.intervals[k].Start > end
+	})
+	if i >= j {
+		return
+	}
+
+	for _, iv := range rs.intervals[i:j] {
+		removed := iv
+		if removed.Start < start {
+			removed.Start = start
+		}
+		if removed.End > end {
+			removed.End = end
+		}
+		rs.events.notify(Removed, removed.Start, removed.End)
+	}
+
+	// Keep the parts of the first and last intervals outside the removed
+	// interval
+	var kept []Interval
+	if rs.intervals[i].Start < start {
+		kept = append(kept, Interval{rs.intervals[i].Start, start - 1})
+	}
+	if rs.intervals[j-1].End > end {
+		kept = append(kept, Interval{end + 1, rs.intervals[j-1].End})
+	}
+
+	rs.replace(i, j, kept...)
+}
+
+// Len returns the number of rounds in the set. If the number of rounds
+// exceeds the maximum int, then the maximum int is returned.
+func (rs *RangeSet) Len() int {
+	rs.mux.RLock()
+	defer rs.mux.RUnlock()
+
+	var n uint64
+	for _, iv := range rs.intervals {
+		size := uint64(iv.End-iv.Start) + 1
+		if size == 0 || n+size < n || n+size > math.MaxInt {
+			return math.MaxInt
+		}
+		n += size
+	}
+
+	return int(n)
+}
+
+// Subscribe returns a new Subscription that receives an Event for every span of
+// rounds inserted into or removed from the set. A call to InsertRange or
+// RemoveRange sends one event for each span of rounds it changes. The buffer
+// is the size of the event channel.
+func (rs *RangeSet) Subscribe(buffer int) *Subscription {
+	return rs.events.subscribe(buffer)
+}
+
+// NumIntervals returns the number of intervals the rounds in the set are
+// stored as.
+func (rs *RangeSet) NumIntervals() int {
+	rs.mux.RLock()
+	defer rs.mux.RUnlock()
+
+	return len(rs.intervals)
+}
+
+// Intervals returns a copy of the excluded intervals in ascending order.
+// Overlapping and adjacent intervals are merged, so no two intervals touch.
+func (rs *RangeSet) Intervals() []Interval {
+	rs.mux.RLock()
+	defer rs.mux.RUnlock()
+
+	intervals := make([]Interval, len(rs.intervals))
+	copy(intervals, rs.intervals)
+	return intervals
+}
+
+// firstEndingAtOrAfter returns the index of the first interval that ends at or
+// after the round, or the number of intervals if there is none.
+func (rs *RangeSet) firstEndingAtOrAfter(rid id.Round) int {
+	return sort.Search(len(rs.intervals), func(k int) bool {
+		return rs.intervals[k].End >= rid
+	})
+}
+
+// replace replaces the intervals from index i up to, but not including, index
+// j with the new intervals.
+func (rs *RangeSet) replace(i, j int, intervals ...Interval) {
+	tail := len(rs.intervals) - j
+	n := i + len(intervals) + tail
+	if n > cap(rs.intervals) {
+		grown := make([]Interval, n, 2*n)
+		copy(grown, rs.intervals[:i])
+		copy(grown[i+len(intervals):], rs.intervals[j:])
+		rs.intervals = grown
+	} else {
+		old := rs.intervals
+		rs.intervals = rs.intervals[:n]
+		copy(rs.intervals[i+len(intervals):], old[j:j+tail])
+	}
+	copy(rs.intervals[i:], intervals)
+}
@@ -0,0 +1,232 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package excludedRounds
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Tests that RangeSet.InsertRange merges overlapping and adjacent intervals and
+// reports whether any round was added.
+func TestRangeSet_InsertRange(t *testing.T) {
+	rs := NewRangeSet()
+
+	tests := []struct {
+		start, end id.Round
+		added      bool
+		expected   []Interval
+	}{
+		{10, 20, true, []Interval{{10, 20}}},
+		{30, 40, true, []Interval{{10, 20}, {30, 40}}},
+		{12, 18, false, []Interval{{10, 20}, {30, 40}}},
+		{21, 29, true, []Interval{{10, 40}}},
+		{50, 60, true, []Interval{{10, 40}, {50, 60}}},
+		{5, 9, true, []Interval{{5, 40}, {50, 60}}},
+		{70, 80, true, []Interval{{5, 40}, {50, 60}, {70, 80}}},
+		{45, 75, true, []Interval{{5, 40}, {45, 80}}},
+		{0, 100, true, []Interval{{0, 100}}},
+		{9, 3, false, []Interval{{0, 100}}},
+		{math.MaxUint64, math.MaxUint64, true,
+			[]Interval{{0, 100}, {math.MaxUint64, math.MaxUint64}}},
+		{101, math.MaxUint64 - 1, true, []Interval{{0, math.MaxUint64}}},
+	}
+
+	for i, tt := range tests {
+		if added := rs.InsertRange(tt.start, tt.end); added != tt.added {
+			t.Errorf("InsertRange(%d, %d) returned unexpected result (%d)."+
+				"\nexpected: %t\nreceived: %t",
+				tt.start, tt.end, i, tt.added, added)
+		}
+		if !reflect.DeepEqual(tt.expected, rs.Intervals()) {
+			t.Errorf("Unexpected intervals after InsertRange(%d, %d) (%d)."+
+				"\nexpected: %v\nreceived: %v",
+				tt.start, tt.end, i, tt.expected, rs.Intervals())
+		}
+	}
+
+	if rs.Len() != math.MaxInt {
+		t.Errorf("Unexpected length of full set.\nexpected: %d\nreceived: %d",
+			math.MaxInt, rs.Len())
+	}
+}
+
+// Tests that RangeSet.RemoveRange splits and trims intervals.
+func TestRangeSet_RemoveRange(t *testing.T) {
+	rs := NewRangeSet()
+	rs.InsertRange(10, 100)
+	rs.InsertRange(200, 300)
+
+	tests := []struct {
+		start, end id.Round
+		expected   []Interval
+	}{
+		{40, 50, []Interval{{10, 39}, {51, 100}, {200, 300}}},
+		{0, 10, []Interval{{11, 39}, {51, 100}, {200, 300}}},
+		{101, 199, []Interval{{11, 39}, {51, 100}, {200, 300}}},
+		{90, 210, []Interval{{11, 39}, {51, 89}, {211, 300}}},
+		{60, 59, []Interval{{11, 39}, {51, 89}, {211, 300}}},
+		{20, 250, []Interval{{11, 19}, {251, 300}}},
+		{0, math.MaxUint64, []Interval{}},
+	}
+
+	for i, tt := range tests {
+		rs.RemoveRange(tt.start, tt.end)
+		if !reflect.DeepEqual(tt.expected, rs.Intervals()) {
+			t.Errorf("Unexpected intervals after RemoveRange(%d, %d) (%d)."+
+				"\nexpected: %v\nreceived: %v",
+				tt.start, tt.end, i, tt.expected, rs.Intervals())
+		}
+	}
+}
+
+// Tests that RangeSet.HasAny finds rounds at the edges of intervals.
+func TestRangeSet_HasAny(t *testing.T) {
+	rs := NewRangeSet()
+	rs.InsertRange(10, 20)
+	rs.InsertRange(30, 40)
+
+	tests := []struct {
+		start, end id.Round
+		expected   bool
+	}{
+		{0, 9, false},
+		{0, 10, true},
+		{20, 29, true},
+		{21, 29, false},
+		{25, 35, true},
+		{40, math.MaxUint64, true},
+		{41, math.MaxUint64, false},
+		{15, 15, true},
+		{20, 10, false},
+	}
+
+	for i, tt := range tests {
+		if has := rs.HasAny(tt.start, tt.end); has != tt.expected {
+			t.Errorf("HasAny(%d, %d) returned unexpected result (%d)."+
+				"\nexpected: %t\nreceived: %t",
+				tt.start, tt.end, i, tt.expected, has)
+		}
+	}
+}
+
+// Tests that a RangeSet matches a Set after random range insertions and
+// removals and that it stores no adjacent or overlapping intervals.
+func TestRangeSet_MatchesSet(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+	rs := NewRangeSet()
+	s := NewSet()
+
+	for i := 0; i < 2000; i++ {
+		start := id.Round(prng.Intn(1000))
+		end := start + id.Round(prng.Intn(50))
+		if prng.Intn(3) == 0 {
+			rs.RemoveRange(start, end)
+			for rid := start; rid <= end; rid++ {
+				s.Remove(rid)
+			}
+		} else {
+			added := false
+			for rid := start; rid <= end; rid++ {
+				added = s.Insert(rid) || added
+			}
+			if rs.InsertRange(start, end) != added {
+				t.Fatalf("InsertRange(%d, %d) returned %t, expected %t (%d).",
+					start, end, !added, added, i)
+			}
+		}
+
+		if rs.Len() != s.Len() {
+			t.Fatalf("Unexpected length (%d).\nexpected: %d\nreceived: %d",
+				i, s.Len(), rs.Len())
+		}
+	}
+
+	for rid := id.Round(0); rid < 1100; rid++ {
+		if rs.Has(rid) != s.Has(rid) {
+			t.Errorf("Unexpected state for round %d.\nexpected: %t"+
+				"\nreceived: %t", rid, s.Has(rid), rs.Has(rid))
+		}
+	}
+
+	intervals := rs.Intervals()
+	if len(intervals) != rs.NumIntervals() {
+		t.Errorf("Unexpected number of intervals.\nexpected: %d\nreceived: %d",
+			rs.NumIntervals(), len(intervals))
+	}
+	for i, iv := range intervals {
+		if iv.Start > iv.End {
+			t.Errorf("Interval %d is inverted: %v", i, iv)
+		}
+		if i > 0 && intervals[i-1].End+1 >= iv.Start {
+			t.Errorf("Intervals %d and %d are not merged: %v, %v",
+				i-1, i, intervals[i-1], iv)
+		}
+	}
+}
+
+// Tests that a RangeSet stores a large span of rounds as a single interval.
+func TestRangeSet_LargeSpan(t *testing.T) {
+	rs := NewRangeSet()
+	if !rs.InsertRange(1, 10_000_000) {
+		t.Errorf("Failed to insert range.")
+	}
+	if !rs.Insert(10_000_001) || rs.Insert(5) {
+		t.Errorf("Unexpected result from Insert.")
+	}
+
+	if rs.NumIntervals() != 1 || rs.Len() != 10_000_001 {
+		t.Errorf("Unexpected number of intervals or length: %d, %d",
+			rs.NumIntervals(), rs.Len())
+	}
+
+	rs.Remove(5_000_000)
+	expected := []Interval{{1, 4_999_999}, {5_000_001, 10_000_001}}
+	if !reflect.DeepEqual(expected, rs.Intervals()) {
+		t.Errorf("Unexpected intervals.\nexpected: %v\nreceived: %v",
+			expected, rs.Intervals())
+	}
+}
+
+// Tests that RangeSet sends one event for each span of rounds changed by
+// InsertRange and RemoveRange.
+func TestRangeSet_Subscribe(t *testing.T) {
+	rs := NewRangeSet()
+	rs.InsertRange(10, 20)
+	rs.InsertRange(30, 40)
+	sub := rs.Subscribe(10)
+
+	rs.InsertRange(15, 35)
+	rs.InsertRange(0, 50)
+	rs.InsertRange(5, 45)
+	rs.RemoveRange(20, 25)
+	rs.InsertRange(21, 60)
+	rs.RemoveRange(10, 70)
+	sub.Unsubscribe()
+
+	var received []Event
+	for e := range sub.Events() {
+		received = append(received, e)
+	}
+
+	expected := []Event{
+		{Inserted, 21, 29},
+		{Inserted, 0, 9}, {Inserted, 41, 50},
+		{Removed, 20, 25},
+		{Inserted, 21, 25}, {Inserted, 51, 60},
+		{Removed, 10, 19}, {Removed, 21, 60},
+	}
+	if !reflect.DeepEqual(expected, received) {
+		t.Errorf("Unexpected events.\nexpected: %v\nreceived: %v",
+			expected, received)
+	}
+}
@@ -10,52 +10,203 @@
 package excludedRounds
 
 import (
+	"bytes"
+	"encoding/binary"
+	"sort"
 	"sync"
 
-	"github.com/golang-collections/collections/set"
+	"github.com/pkg/errors"
 
 	"gitlab.com/xx_network/primitives/id"
 )
 
-// Set struct contains a set of rounds to be excluded from cmix
+// Current encoding version of a marshalled Set.
+const setVersion = 0
+
+// ErrCorruptEncoding is returned, wrapped, when marshalled excluded rounds
+// cannot be decoded. It can be tested for with errors.Is.
+var ErrCorruptEncoding = errors.New("corrupt excluded rounds encoding")
+
+// Set struct contains a set of rounds to be excluded from cmix. It is safe for
+// concurrent use.
+//
+// Migration note: Set was previously backed by
+// github.com/golang-collections/collections/set, which stored rounds as
+// interface{} values, and NewSet inserted a nil element into it. As a result,
+// Len on a new Set returned 1 and every count was one larger than the number
+// of rounds. Set is now backed by a map[id.Round]struct{} and Len returns the
+// true number of rounds; callers that compensated for the extra element must
+// stop subtracting one.
 type Set struct {
-	xr *set.Set
+	xr     map[id.Round]struct{}
+	events notifier
 	sync.RWMutex
 }
 
+// Set adheres to the ExcludedRounds and Observable interfaces.
+var (
+	_ ExcludedRounds = (*Set)(nil)
+	_ Observable     = (*Set)(nil)
+)
+
+// NewSet returns a new empty Set.
 func NewSet() *Set {
-	return &Set{xr: set.New(nil)}
+	return &Set{xr: make(map[id.Round]struct{})}
 }
 
+// Has indicates if the round is in the set.
 func (s *Set) Has(rid id.Round) bool {
 	s.RLock()
 	defer s.RUnlock()
 
-	return s.xr.Has(rid)
+	_, exists := s.xr[rid]
+	return exists
 }
 
+// Insert adds the round to the set. Returns true if the round was added and
+// false if it was already in the set.
 func (s *Set) Insert(rid id.Round) bool {
 	s.Lock()
 	defer s.Unlock()
 
-	if s.xr.Has(rid) {
+	if _, exists := s.xr[rid]; exists {
 		return false
 	}
 
-	s.xr.Insert(rid)
+	s.xr[rid] = struct{}{}
+	s.events.notify(Inserted, rid, rid)
 	return true
 }
 
+// Remove deletes the round from the set.
 func (s *Set) Remove(rid id.Round) {
 	s.Lock()
 	defer s.Unlock()
 
-	s.xr.Remove(rid)
+	if _, exists := s.xr[rid]; exists {
+		delete(s.xr, rid)
+		s.events.notify(Removed, rid, rid)
+	}
 }
 
+// Len returns the number of rounds in the set.
 func (s *Set) Len() int {
 	s.RLock()
 	defer s.RUnlock()
 
-	return s.xr.Len()
+	return len(s.xr)
+}
+
+// Subscribe returns a new Subscription that receives an Event for every round
+// inserted into or removed from the set. Rounds loaded with Unmarshal do not
+// send events. The buffer is the size of the event channel.
+func (s *Set) Subscribe(buffer int) *Subscription {
+	return s.events.subscribe(buffer)
+}
+
+// Marshal encodes the rounds in the set into a byte slice. The rounds are
+// sorted and each round is stored as the difference from the previous round
+// to keep the encoding small.
+//
+// The data is encoded in the following structure:
+// +---------+---------+---------+---------------+-----+
+// | version |  count  | round 1 | round delta 2 | ... |
+// | 1 byte  | uvarint | uvarint |    uvarint    |     |
+// +---------+---------+---------+---------------+-----+
+func (s *Set) Marshal() []byte {
+	return marshalRounds(s.list())
+}
+
+// list returns the rounds in the set in no particular order.
+func (s *Set) list() []id.Round {
+	s.RLock()
+	defer s.RUnlock()
+
+	rounds := make([]id.Round, 0, len(s.xr))
+	for rid := range s.xr {
+		rounds = append(rounds, rid)
+	}
+
+	return rounds
+}
+
+// marshalRounds encodes the distinct rounds in the format described by
+// Set.Marshal. The slice is sorted in place.
+func marshalRounds(rounds []id.Round) []byte {
+	sort.Slice(rounds, func(i, j int) bool { return rounds[i] < rounds[j] })
+
+	data := make([]byte, 1, 1+binary.MaxVarintLen64*(len(rounds)+1))
+	data[0] = setVersion
+	data = binary.AppendUvarint(data, uint64(len(rounds)))
+
+	prev := id.Round(0)
+	for _, rid := range rounds {
+		data = binary.AppendUvarint(data, uint64(rid-prev))
+		prev = rid
+	}
+
+	return data
+}
+
+// Unmarshal decodes the byte slice produced by Set.Marshal and replaces the
+// rounds in the set with the decoded rounds. Malformed data returns an error
+// wrapping ErrCorruptEncoding and leaves the set unmodified.
+func (s *Set) Unmarshal(data []byte) error {
+	xr, err := unmarshalRounds(data)
+	if err != nil {
+		return err
+	}
+
+	s.Lock()
+	s.xr = xr
+	s.Unlock()
+
+	return nil
+}
+
+// unmarshalRounds decodes the byte slice produced by Set.Marshal into a map of
+// rounds.
+func unmarshalRounds(data []byte) (map[id.Round]struct{}, error) {
+	if len(data) == 0 {
+		return nil, errors.Wrap(ErrCorruptEncoding, "Set data is empty")
+	} else if data[0] != setVersion {
+		return nil, errors.Wrapf(ErrCorruptEncoding,
+			"Set encoding version %d unrecognized", data[0])
+	}
+	buf := bytes.NewReader(data[1:])
+
+	count, err := binary.ReadUvarint(buf)
+	if err != nil {
+		return nil, errors.Wrapf(ErrCorruptEncoding,
+			"failed to read Set count: %+v", err)
+	} else if count > uint64(buf.Len()) {
+		return nil, errors.Wrapf(ErrCorruptEncoding, "Set count %d larger "+
+			"than remaining data of size %d", count, buf.Len())
+	}
+
+	xr := make(map[id.Round]struct{}, count)
+	rid := id.Round(0)
+	for n := uint64(0); n < count; n++ {
+		delta, err := binary.ReadUvarint(buf)
+		if err != nil {
+			return nil, errors.Wrapf(ErrCorruptEncoding,
+				"failed to read round %d: %+v", n, err)
+		} else if n > 0 && delta == 0 {
+			return nil, errors.Wrapf(ErrCorruptEncoding,
+				"duplicate round %d at index %d", rid, n)
+		} else if uint64(rid)+delta < uint64(rid) {
+			return nil, errors.Wrapf(ErrCorruptEncoding,
+				"round at index %d overflows", n)
+		}
+
+		rid += id.Round(delta)
+		xr[rid] = struct{}{}
+	}
+
+	if buf.Len() != 0 {
+		return nil, errors.Wrapf(ErrCorruptEncoding, "extraneous data of "+
+			"length %d found at end of Set", buf.Len())
+	}
+
+	return xr, nil
 }
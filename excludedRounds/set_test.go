@@ -8,6 +8,11 @@
 package excludedRounds
 
 import (
+	"bytes"
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
 	"testing"
 
 	"gitlab.com/xx_network/primitives/id"
@@ -15,8 +20,8 @@ import (
 
 func TestSet(t *testing.T) {
 	s := NewSet()
-	if s.Len() != 1 {
-		t.Errorf("Unexpected length.\nexpected: %d\nreceived: %d", 1, s.Len())
+	if s.Len() != 0 {
+		t.Errorf("Unexpected length.\nexpected: %d\nreceived: %d", 0, s.Len())
 	}
 	rid1 := id.Round(400)
 	if s.Has(rid1) {
@@ -31,14 +36,121 @@ func TestSet(t *testing.T) {
 	if !s.Has(rid1) {
 		t.Errorf("Should have found inserted round in excluded round set")
 	}
-	if s.Len() != 2 {
-		t.Errorf("Unexpected length.\nexpected: %d\nreceived: %d", 2, s.Len())
+	if s.Len() != 1 {
+		t.Errorf("Unexpected length.\nexpected: %d\nreceived: %d", 1, s.Len())
 	}
 	s.Remove(rid1)
 	if s.Has(rid1) {
 		t.Errorf("Should not have found round in excluded round set")
 	}
-	if s.Len() != 1 {
-		t.Errorf("Unexpected length.\nexpected: %d\nreceived: %d", 1, s.Len())
+	if s.Len() != 0 {
+		t.Errorf("Unexpected length.\nexpected: %d\nreceived: %d", 0, s.Len())
+	}
+}
+
+// Tests that Set.Len returns the number of rounds after many inserts and
+// removals.
+func TestSet_Len(t *testing.T) {
+	s := NewSet()
+	for rid := id.Round(0); rid < 1000; rid++ {
+		s.Insert(rid)
+		s.Insert(rid)
+	}
+	for rid := id.Round(0); rid < 1000; rid += 2 {
+		s.Remove(rid)
+	}
+	s.Remove(5000)
+
+	if s.Len() != 500 {
+		t.Errorf("Unexpected length.\nexpected: %d\nreceived: %d", 500, s.Len())
+	}
+}
+
+// Tests that Set.Has and Set.Insert of an existing round do not allocate.
+func TestSet_NoAllocations(t *testing.T) {
+	s := NewSet()
+	s.Insert(42)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		s.Has(42)
+		s.Has(43)
+		s.Insert(42)
+	})
+	if allocs != 0 {
+		t.Errorf("Unexpected allocations.\nexpected: %d\nreceived: %.0f",
+			0, allocs)
+	}
+}
+
+// Tests that a Set marshalled via Set.Marshal and unmarshalled via
+// Set.Unmarshal contains the same rounds.
+func TestSet_Marshal_Unmarshal(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 20; i++ {
+		s := NewSet()
+		for j := 0; j < prng.Intn(500); j++ {
+			s.Insert(id.Round(prng.Uint64() >> uint(prng.Intn(64))))
+		}
+		if i == 0 {
+			s.Insert(0)
+			s.Insert(math.MaxUint64)
+		}
+
+		newSet := NewSet()
+		newSet.Insert(12345678)
+		if err := newSet.Unmarshal(s.Marshal()); err != nil {
+			t.Fatalf("Unmarshal returned an error (%d): %+v", i, err)
+		}
+
+		if !reflect.DeepEqual(s.xr, newSet.xr) {
+			t.Errorf("Unmarshalled set does not match original (%d)."+
+				"\nexpected: %v\nreceived: %v", i, s.xr, newSet.xr)
+		}
+	}
+}
+
+// Tests that Set.Marshal produces the expected sorted, delta-encoded output.
+func TestSet_Marshal(t *testing.T) {
+	s := NewSet()
+	for _, rid := range []id.Round{1000, 5, 1001, 300} {
+		s.Insert(rid)
+	}
+
+	expected := []byte{setVersion, 4, 5, 0xA7, 0x02, 0xBC, 0x05, 1}
+	if data := s.Marshal(); !bytes.Equal(expected, data) {
+		t.Errorf("Unexpected marshalled data.\nexpected: %v\nreceived: %v",
+			expected, data)
+	}
+}
+
+// Error path: Tests that Set.Unmarshal returns an error wrapping
+// ErrCorruptEncoding for malformed data and does not modify the set.
+func TestSet_Unmarshal_CorruptEncoding(t *testing.T) {
+	testData := [][]byte{
+		nil,
+		{1, 0},                // Unrecognized version
+		{setVersion},          // Missing count
+		{setVersion, 3, 1, 2}, // Count larger than data
+		{setVersion, 2, 5, 0}, // Duplicate round
+		{setVersion, 1, 0x80}, // Truncated uvarint
+		{setVersion, 1, 5, 7}, // Extraneous data
+		append([]byte{setVersion, 2, 2}, // Overflowing round
+			0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x01),
+	}
+
+	for i, data := range testData {
+		s := NewSet()
+		s.Insert(42)
+
+		err := s.Unmarshal(data)
+		if !errors.Is(err, ErrCorruptEncoding) {
+			t.Errorf("Unmarshal did not return the expected error (%d)."+
+				"\nexpected: %v\nreceived: %+v", i, ErrCorruptEncoding, err)
+		}
+
+		if s.Len() != 1 || !s.Has(42) {
+			t.Errorf("Set modified on error (%d): %v", i, s.xr)
+		}
 	}
 }
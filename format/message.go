@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"strconv"
 
+	"github.com/pkg/errors"
 	"golang.org/x/crypto/blake2b"
 
 	jww "github.com/spf13/jwalterweatherman"
@@ -32,6 +33,22 @@ const (
 	messagePayloadVersion = 0
 )
 
+// Errors returned, wrapped, by the error-returning constructors and setters of
+// Message. They can be tested for with errors.Is.
+var (
+	// ErrPrimeTooSmall is returned when the prime size is smaller than
+	// MinimumPrimeSize.
+	ErrPrimeTooSmall = errors.New("prime size is too small")
+
+	// ErrInvalidLength is returned when data does not have the length
+	// required by the field it is set to.
+	ErrInvalidLength = errors.New("invalid length")
+
+	// ErrFirstBitSet is returned when the first bit of data that must be
+	// within the group is not zero.
+	ErrFirstBitSet = errors.New("first bit must be zero")
+)
+
 /*
                             Message Structure (not to scale)
 +----------------------------------------------------------------------------------------------------+
@@ -82,12 +99,31 @@ type Message struct {
 // primes. All subcomponents point to locations in the internal data buffer.
 // Panics if the prime size to too small.
 func NewMessage(numPrimeBytes int) Message {
+	m, err := NewMessageE(numPrimeBytes)
+	if err != nil {
+		jww.FATAL.Panicf("Failed to create new Message: %+v", err)
+	}
+
+	return m
+}
+
+// NewMessageE creates a new empty message like NewMessage but returns an error
+// wrapping ErrPrimeTooSmall instead of panicking if the prime size is too
+// small.
+func NewMessageE(numPrimeBytes int) (Message, error) {
 	if numPrimeBytes < MinimumPrimeSize {
-		jww.FATAL.Panicf("Failed to create new Message: minimum prime length "+
-			"is %d, received prime size is %d.", MinimumPrimeSize, numPrimeBytes)
+		return Message{}, errors.WithMessagef(ErrPrimeTooSmall, "minimum "+
+			"prime length is %d, received prime size is %d",
+			MinimumPrimeSize, numPrimeBytes)
 	}
 
-	data := make([]byte, 2*numPrimeBytes)
+	return newMessage(make([]byte, 2*numPrimeBytes)), nil
+}
+
+// newMessage creates a message backed by the given data, which must have an
+// even length of at least 2*MinimumPrimeSize.
+func newMessage(data []byte) Message {
+	numPrimeBytes := len(data) / 2
 
 	return Message{
 		data: data,
@@ -127,10 +163,20 @@ func (m *Message) MarshalImmutable() []byte {
 	return newM.data
 }
 
-// Unmarshal unmarshalls a byte slice into a new Message.
+// Unmarshal unmarshalls a byte slice into a new Message. The byte slice is
+// copied. Returns an error wrapping ErrInvalidLength if the length of the byte
+// slice is odd or too short to hold a message.
 func Unmarshal(b []byte) (Message, error) {
-	m := NewMessage(len(b) / 2)
-	copy(m.data, b)
+	if len(b)%2 != 0 {
+		return Message{}, errors.WithMessagef(ErrInvalidLength,
+			"message length must be even, received length is %d", len(b))
+	} else if len(b) < 2*MinimumPrimeSize {
+		return Message{}, errors.WithMessagef(ErrInvalidLength,
+			"message length must be at least %d, received length is %d",
+			2*MinimumPrimeSize, len(b))
+	}
+
+	m := newMessage(copyByteSlice(b))
 
 	// if m.Version() != messagePayloadVersion {
 	// 	return Message{}, fmt.Errorf(
@@ -166,12 +212,21 @@ func (m Message) GetPayloadA() []byte {
 // SetPayloadA copies the passed byte slice into payload A. If the specified
 // byte slice is not exactly the same size as payload A, then it panics.
 func (m Message) SetPayloadA(payload []byte) {
-	if len(payload) != len(m.payloadB) {
-		jww.ERROR.Panicf("Failed to set Message payload A: length must be %d, "+
-			"length of received data is %d.", len(m.payloadA), len(payload))
+	if err := m.TrySetPayloadA(payload); err != nil {
+		jww.ERROR.Panicf("Failed to set Message payload A: %+v", err)
+	}
+}
+
+// TrySetPayloadA copies the passed byte slice into payload A. Returns an error
+// wrapping ErrInvalidLength if the byte slice is not exactly the same size as
+// payload A.
+func (m Message) TrySetPayloadA(payload []byte) error {
+	if err := checkLen(payload, len(m.payloadA)); err != nil {
+		return err
 	}
 
 	copy(m.payloadA, payload)
+	return nil
 }
 
 // GetPayloadB returns payload B, which is the last half of the message.
@@ -182,12 +237,21 @@ func (m Message) GetPayloadB() []byte {
 // SetPayloadB copies the passed byte slice into payload B. If the specified
 // byte slice is not exactly the same size as payload B, then it panics.
 func (m Message) SetPayloadB(payload []byte) {
-	if len(payload) != len(m.payloadB) {
-		jww.ERROR.Panicf("Failed to set Message payload B: length must be %d, "+
-			"length of received data is %d.", len(m.payloadB), len(payload))
+	if err := m.TrySetPayloadB(payload); err != nil {
+		jww.ERROR.Panicf("Failed to set Message payload B: %+v", err)
+	}
+}
+
+// TrySetPayloadB copies the passed byte slice into payload B. Returns an error
+// wrapping ErrInvalidLength if the byte slice is not exactly the same size as
+// payload B.
+func (m Message) TrySetPayloadB(payload []byte) error {
+	if err := checkLen(payload, len(m.payloadB)); err != nil {
+		return err
 	}
 
 	copy(m.payloadB, payload)
+	return nil
 }
 
 // ContentsSize returns the maximum size of the contents.
@@ -211,9 +275,18 @@ func (m Message) GetContents() []byte {
 // contents. Panics if the passed contents is larger than the maximum contents
 // size.
 func (m Message) SetContents(c []byte) {
+	if err := m.TrySetContents(c); err != nil {
+		jww.ERROR.Panicf("Failed to set Message contents: %+v", err)
+	}
+}
+
+// TrySetContents sets the contents of the message like SetContents. Returns an
+// error wrapping ErrInvalidLength if the passed contents is larger than the
+// maximum contents size.
+func (m Message) TrySetContents(c []byte) error {
 	if len(c) > len(m.contents1)+len(m.contents2) {
-		jww.ERROR.Panicf("Failed to set Message contents: length must be "+
-			"equal to or less than %d, length of received data is %d.",
+		return errors.WithMessagef(ErrInvalidLength, "length must be equal "+
+			"to or less than %d, length of received data is %d",
 			len(m.contents1)+len(m.contents2), len(c))
 	}
 
@@ -223,6 +296,8 @@ func (m Message) SetContents(c []byte) {
 		copy(m.contents1, c[:len(m.contents1)])
 		copy(m.contents2, c[len(m.contents1):])
 	}
+
+	return nil
 }
 
 // GetRawContentsSize returns the exact contents of the message.
@@ -248,12 +323,21 @@ func (m Message) GetRawContents() []byte {
 // message. If the passed contents is larger than the maximum contents size this
 // will panic.
 func (m Message) SetRawContents(c []byte) {
-	if len(c) != len(m.rawContents) {
-		jww.ERROR.Panicf("Failed to set Message raw contents: length must be %d, "+
-			"length of received data is %d.", len(m.rawContents), len(c))
+	if err := m.TrySetRawContents(c); err != nil {
+		jww.ERROR.Panicf("Failed to set Message raw contents: %+v", err)
+	}
+}
+
+// TrySetRawContents sets the raw contents of the message like SetRawContents.
+// Returns an error wrapping ErrInvalidLength if the passed contents is not
+// exactly the raw contents size.
+func (m Message) TrySetRawContents(c []byte) error {
+	if err := checkLen(c, len(m.rawContents)); err != nil {
+		return err
 	}
 
 	copy(m.rawContents, c)
+	return nil
 }
 
 // GetKeyFP gets the key Fingerprint
@@ -267,12 +351,20 @@ func (m Message) GetKeyFP() Fingerprint {
 // SetKeyFP sets the key Fingerprint. Checks that the first bit of the Key
 // Fingerprint is 0, otherwise it panics.
 func (m Message) SetKeyFP(fp Fingerprint) {
+	if err := m.TrySetKeyFP(fp); err != nil {
+		jww.ERROR.Panicf("Failed to set Message key fingerprint: %+v", err)
+	}
+}
+
+// TrySetKeyFP sets the key Fingerprint. Returns ErrFirstBitSet if the first bit
+// of the Key Fingerprint is not 0.
+func (m Message) TrySetKeyFP(fp Fingerprint) error {
 	if fp[0]>>7 != 0 {
-		jww.ERROR.Panicf("Failed to set Message key fingerprint: first bit " +
-			"of provided data must be zero.")
+		return ErrFirstBitSet
 	}
 
 	copy(m.keyFP, fp.Bytes())
+	return nil
 }
 
 // GetMac gets the MAC.
@@ -286,17 +378,23 @@ func (m Message) GetMac() []byte {
 // SetMac sets the MAC. Checks that the first bit of the MAC is 0, otherwise it
 // panics.
 func (m Message) SetMac(mac []byte) {
-	if len(mac) != MacLen {
-		jww.ERROR.Panicf("Failed to set Message MAC: length must be %d, "+
-			"length of received data is %d.", MacLen, len(mac))
+	if err := m.TrySetMac(mac); err != nil {
+		jww.ERROR.Panicf("Failed to set Message MAC: %+v", err)
 	}
+}
 
-	if mac[0]>>7 != 0 {
-		jww.ERROR.Panicf("Failed to set Message MAC: first bit of provided " +
-			"data must be zero.")
+// TrySetMac sets the MAC. Returns an error wrapping ErrInvalidLength if the MAC
+// is not MacLen bytes long or ErrFirstBitSet if the first bit of the MAC is
+// not 0.
+func (m Message) TrySetMac(mac []byte) error {
+	if err := checkLen(mac, MacLen); err != nil {
+		return err
+	} else if mac[0]>>7 != 0 {
+		return ErrFirstBitSet
 	}
 
 	copy(m.mac, mac)
+	return nil
 }
 
 // GetEphemeralRID returns the ephemeral recipient ID.
@@ -306,12 +404,22 @@ func (m Message) GetEphemeralRID() []byte {
 
 // SetEphemeralRID copies the ephemeral recipient ID bytes into the message.
 func (m Message) SetEphemeralRID(ephemeralRID []byte) {
-	if len(ephemeralRID) != EphemeralRIDLen {
-		jww.ERROR.Panicf("Failed to set Message ephemeral recipient ID: "+
-			"length must be %d, length of received data is %d.",
-			EphemeralRIDLen, len(ephemeralRID))
+	if err := m.TrySetEphemeralRID(ephemeralRID); err != nil {
+		jww.ERROR.Panicf(
+			"Failed to set Message ephemeral recipient ID: %+v", err)
+	}
+}
+
+// TrySetEphemeralRID copies the ephemeral recipient ID bytes into the message.
+// Returns an error wrapping ErrInvalidLength if the ID is not EphemeralRIDLen
+// bytes long.
+func (m Message) TrySetEphemeralRID(ephemeralRID []byte) error {
+	if err := checkLen(ephemeralRID, EphemeralRIDLen); err != nil {
+		return err
 	}
+
 	copy(m.ephemeralRID, ephemeralRID)
+	return nil
 }
 
 // GetSIH return the Service Identification Hash.
@@ -322,12 +430,20 @@ func (m Message) GetSIH() []byte {
 // SetSIH sets the Service Identification Hash, which should be generated via
 // fingerprint.IdentityFP.
 func (m Message) SetSIH(identityFP []byte) {
-	if len(identityFP) != SIHLen {
-		jww.ERROR.Panicf("Failed to set Service Identification Hash: length "+
-			"must be %d, length of received data is %d.",
-			SIHLen, len(identityFP))
+	if err := m.TrySetSIH(identityFP); err != nil {
+		jww.ERROR.Panicf("Failed to set Service Identification Hash: %+v", err)
+	}
+}
+
+// TrySetSIH sets the Service Identification Hash. Returns an error wrapping
+// ErrInvalidLength if the hash is not SIHLen bytes long.
+func (m Message) TrySetSIH(identityFP []byte) error {
+	if err := checkLen(identityFP, SIHLen); err != nil {
+		return err
 	}
+
 	copy(m.sih, identityFP)
+	return nil
 }
 
 // Digest gets a digest of the message contents, primarily used for debugging
@@ -344,6 +460,16 @@ func DigestContents(c []byte) string {
 	return digest[:20]
 }
 
+// checkLen returns an error wrapping ErrInvalidLength if the byte slice is not
+// of the expected length.
+func checkLen(b []byte, expected int) error {
+	if len(b) != expected {
+		return errors.WithMessagef(ErrInvalidLength, "length must be %d, "+
+			"length of received data is %d", expected, len(b))
+	}
+	return nil
+}
+
 // copyByteSlice is a helper function to make a copy of a byte slice.
 func copyByteSlice(s []byte) []byte {
 	c := make([]byte, len(s))
@@ -9,6 +9,7 @@ package format
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"math/rand"
 	"reflect"
@@ -124,6 +125,29 @@ func TestNewMessage_NumPrimeBytesError(t *testing.T) {
 	_ = NewMessage(MinimumPrimeSize - 1)
 }
 
+// Happy path.
+func TestNewMessageE(t *testing.T) {
+	msg, err := NewMessageE(MinimumPrimeSize)
+	if err != nil {
+		t.Fatalf("NewMessageE returned an error: %+v", err)
+	}
+
+	if !reflect.DeepEqual(NewMessage(MinimumPrimeSize), msg) {
+		t.Errorf("NewMessageE did not return the same Message as NewMessage."+
+			"\nexpected: %+v\nreceived: %+v", NewMessage(MinimumPrimeSize), msg)
+	}
+}
+
+// Error path: returns an error if provided prime size is too small.
+func TestNewMessageE_NumPrimeBytesError(t *testing.T) {
+	_, err := NewMessageE(MinimumPrimeSize - 1)
+	if !errors.Is(err, ErrPrimeTooSmall) {
+		t.Errorf("NewMessageE did not return the expected error when the "+
+			"minimum prime size is too small.\nexpected: %v\nreceived: %+v",
+			ErrPrimeTooSmall, err)
+	}
+}
+
 // Happy path.
 func TestMessage_Marshal_Unmarshal(t *testing.T) {
 	m := NewMessage(256)
@@ -178,6 +202,76 @@ func TestMessage_Marshal_UnmarshalImmutable(t *testing.T) {
 	}
 }
 
+// Error path: Tests that Unmarshal returns an error for data with an odd
+// length or that is too short to hold a message.
+func TestUnmarshal_LengthError(t *testing.T) {
+	lengths := []int{0, 1, 2*MinimumPrimeSize - 2, 2*MinimumPrimeSize + 1}
+	for _, n := range lengths {
+		_, err := Unmarshal(make([]byte, n))
+		if !errors.Is(err, ErrInvalidLength) {
+			t.Errorf("Unmarshal did not return the expected error for data "+
+				"of length %d.\nexpected: %v\nreceived: %+v",
+				n, ErrInvalidLength, err)
+		}
+	}
+}
+
+// Tests that Unmarshal copies the data so that modifying it afterwards does not
+// modify the Message.
+func TestUnmarshal_Copy(t *testing.T) {
+	data := makeAndFillSlice(2*MinimumPrimeSize, 'a')
+	msg, err := Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal returned an error: %+v", err)
+	}
+
+	data[0] = 'b'
+	if msg.Marshal()[0] != 'a' {
+		t.Errorf("Unmarshal did not copy the data; modifications to the data " +
+			"reflected in the Message.")
+	}
+}
+
+// FuzzUnmarshal tests that Unmarshal never panics and that it either returns an
+// ErrInvalidLength error or a Message that marshals to the original data and
+// whose accessors do not panic.
+func FuzzUnmarshal(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{1})
+	f.Add(make([]byte, 2*MinimumPrimeSize))
+	f.Add(make([]byte, 2*MinimumPrimeSize+1))
+	f.Add(bytes.Repeat([]byte{0xFF}, 512))
+	msg := generateMsg()
+	f.Add(msg.Marshal())
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg, err := Unmarshal(data)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidLength) {
+				t.Fatalf("Unexpected error for data of length %d: %+v",
+					len(data), err)
+			}
+			return
+		}
+
+		if !bytes.Equal(data, msg.Marshal()) {
+			t.Errorf("Marshalled Message does not match unmarshalled data."+
+				"\nexpected: %v\nreceived: %v", data, msg.Marshal())
+		}
+		if 2*msg.GetPrimeByteLen() != len(data) {
+			t.Errorf("Unexpected prime length.\nexpected: %d\nreceived: %d",
+				len(data)/2, msg.GetPrimeByteLen())
+		}
+
+		_ = msg.GoString()
+		_ = msg.GetRawContents()
+		_ = msg.MarshalImmutable()
+		if err = msg.TrySetContents(msg.GetContents()); err != nil {
+			t.Errorf("Failed to set contents of the Message: %+v", err)
+		}
+	})
+}
+
 // Happy path.
 func TestMessage_Version(t *testing.T) {
 	msg := NewMessage(MinimumPrimeSize)
@@ -733,6 +827,117 @@ func TestMessage_SetIdentityFP_LengthError(t *testing.T) {
 	msg.SetSIH(make([]byte, SIHLen*2))
 }
 
+// Error path: Tests that each error-returning setter returns the expected
+// error for invalid data and leaves the Message unmodified.
+func TestMessage_TrySet_Errors(t *testing.T) {
+	msg := generateMsg()
+	expected := msg.Marshal()
+	firstBitSet := func(n int) []byte {
+		b := make([]byte, n)
+		b[0] = 0b10000000
+		return b
+	}
+
+	tests := []struct {
+		name     string
+		set      func() error
+		expected error
+	}{
+		{"TrySetPayloadA", func() error {
+			return msg.TrySetPayloadA(make([]byte, MinimumPrimeSize-1))
+		}, ErrInvalidLength},
+		{"TrySetPayloadB", func() error {
+			return msg.TrySetPayloadB(make([]byte, MinimumPrimeSize+1))
+		}, ErrInvalidLength},
+		{"TrySetContents", func() error {
+			return msg.TrySetContents(make([]byte, msg.ContentsSize()+1))
+		}, ErrInvalidLength},
+		{"TrySetRawContents", func() error {
+			raw := make([]byte, msg.GetRawContentsSize()-1)
+			return msg.TrySetRawContents(raw)
+		}, ErrInvalidLength},
+		{"TrySetKeyFP", func() error {
+			return msg.TrySetKeyFP(NewFingerprint(firstBitSet(KeyFPLen)))
+		}, ErrFirstBitSet},
+		{"TrySetMac length", func() error {
+			return msg.TrySetMac(make([]byte, MacLen-1))
+		}, ErrInvalidLength},
+		{"TrySetMac first bit", func() error {
+			return msg.TrySetMac(firstBitSet(MacLen))
+		}, ErrFirstBitSet},
+		{"TrySetMac nil", func() error {
+			return msg.TrySetMac(nil)
+		}, ErrInvalidLength},
+		{"TrySetEphemeralRID", func() error {
+			return msg.TrySetEphemeralRID(make([]byte, EphemeralRIDLen+1))
+		}, ErrInvalidLength},
+		{"TrySetSIH", func() error {
+			return msg.TrySetSIH(make([]byte, SIHLen-1))
+		}, ErrInvalidLength},
+	}
+
+	for _, tt := range tests {
+		if err := tt.set(); !errors.Is(err, tt.expected) {
+			t.Errorf("%s did not return the expected error."+
+				"\nexpected: %v\nreceived: %+v", tt.name, tt.expected, err)
+		}
+		if !bytes.Equal(expected, msg.Marshal()) {
+			t.Errorf("%s modified the Message after returning an error.",
+				tt.name)
+		}
+	}
+}
+
+// Happy path: Tests that the error-returning setters set the same data as the
+// panicking setters.
+func TestMessage_TrySet(t *testing.T) {
+	msg, expected := NewMessage(MinimumPrimeSize), NewMessage(MinimumPrimeSize)
+	prng := rand.New(rand.NewSource(42))
+	contents := make([]byte, msg.ContentsSize())
+	prng.Read(contents)
+	mac := make([]byte, MacLen)
+	prng.Read(mac)
+	mac[0] &= 0b01111111
+	ephemeralRID := make([]byte, EphemeralRIDLen)
+	prng.Read(ephemeralRID)
+	sih := make([]byte, SIHLen)
+	prng.Read(sih)
+	keyFP := NewFingerprint(mac)
+
+	for _, err := range []error{
+		msg.TrySetContents(contents),
+		msg.TrySetKeyFP(keyFP),
+		msg.TrySetMac(mac),
+		msg.TrySetEphemeralRID(ephemeralRID),
+		msg.TrySetSIH(sih),
+	} {
+		if err != nil {
+			t.Errorf("Setter returned an error: %+v", err)
+		}
+	}
+
+	expected.SetContents(contents)
+	expected.SetKeyFP(keyFP)
+	expected.SetMac(mac)
+	expected.SetEphemeralRID(ephemeralRID)
+	expected.SetSIH(sih)
+
+	if !bytes.Equal(expected.Marshal(), msg.Marshal()) {
+		t.Errorf("Error-returning setters did not set the expected data."+
+			"\nexpected: %v\nreceived: %v", expected.Marshal(), msg.Marshal())
+	}
+
+	if err := msg.TrySetPayloadA(expected.GetPayloadB()); err != nil {
+		t.Errorf("TrySetPayloadA returned an error: %+v", err)
+	}
+	if err := msg.TrySetPayloadB(expected.GetPayloadA()); err != nil {
+		t.Errorf("TrySetPayloadB returned an error: %+v", err)
+	}
+	if err := msg.TrySetRawContents(expected.GetRawContents()); err != nil {
+		t.Errorf("TrySetRawContents returned an error: %+v", err)
+	}
+}
+
 // Tests that digests come out correctly and are different.
 func TestMessage_Digest(t *testing.T) {
 
@@ -4,7 +4,6 @@ go 1.19
 
 require (
 	github.com/badoux/checkmail v1.2.1
-	github.com/golang-collections/collections v0.0.0-20130729185459-604e922904d3
 	github.com/pkg/errors v0.9.1
 	github.com/spf13/jwalterweatherman v1.1.0
 	github.com/ttacon/libphonenumber v1.2.1
@@ -0,0 +1,103 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package knownRounds
+
+import (
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Clone returns a deep copy of the KnownRounds, including its capacity and
+// maximum capacity.
+func (kr *KnownRounds) Clone() *KnownRounds {
+	return &KnownRounds{
+		bitStream:      kr.bitStream.deepCopy(),
+		firstUnchecked: kr.firstUnchecked,
+		lastChecked:    kr.lastChecked,
+		fuPos:          kr.fuPos,
+		maxBlocks:      kr.maxBlocks,
+	}
+}
+
+// Equal determines if both KnownRounds have the same check state for every
+// round. The capacity of the buffers, the position of the rounds in them, and
+// any data outside the windows are ignored.
+func (kr *KnownRounds) Equal(other *KnownRounds) bool {
+	if kr == nil || other == nil {
+		return kr == other
+	}
+
+	// Rounds before both windows are checked and rounds after both windows
+	// are unchecked in both, so only the union of the windows is compared
+	low, high := kr.firstUnchecked, kr.checkedEnd()
+	if other.firstUnchecked < low {
+		low = other.firstUnchecked
+	}
+	if otherEnd := other.checkedEnd(); otherEnd > high {
+		high = otherEnd
+	}
+
+	if high < low {
+		return true
+	}
+
+	for ws := low; ; ws += 64 {
+		diff := kr.getWord(ws) ^ other.getWord(ws)
+		if high-ws < 63 {
+			diff &= ^(ones >> uint(high-ws+1))
+		}
+
+		if diff != 0 {
+			return false
+		} else if high-ws < 64 {
+			return true
+		}
+	}
+}
+
+// Canonicalize rewrites the KnownRounds into a canonical form without changing
+// the check state of any round, so that KnownRounds with equal state, as
+// determined by Equal, and equal capacity produce the same output from
+// Marshal. This is useful for content hashing.
+//
+// In canonical form, the ring buffer is rotated so that the block containing
+// firstUnchecked is the first block, with fuPos equal to the position of
+// firstUnchecked in its block (0 when firstUnchecked is a multiple of 64).
+// Every bit outside the window is cleared and lastChecked is the newest
+// checked round, or firstUnchecked if no rounds in the window are checked.
+func (kr *KnownRounds) Canonicalize() {
+	// Find the newest checked round in the window
+	lastChecked := kr.firstUnchecked
+	kr.Iterate(func(_, end id.Round) bool {
+		lastChecked = end - 1
+		return true
+	})
+	kr.lastChecked = lastChecked
+
+	if len(kr.bitStream) == 0 {
+		return
+	}
+
+	// Read every block starting at the block containing firstUnchecked. The
+	// bits before firstUnchecked in the first block hold the rounds that wrap
+	// around past the end of the buffer.
+	offset := uint(kr.firstUnchecked % 64)
+	base := kr.firstUnchecked - id.Round(offset)
+	newBuff := make(uint64Buff, len(kr.bitStream))
+	for i := range newBuff {
+		newBuff[i] = kr.getWord(base + id.Round(i*64))
+	}
+
+	head := uint64(ones) >> offset
+	newBuff[0] = newBuff[0]&head | kr.getWord(base+id.Round(kr.Len()))&^head
+
+	// firstUnchecked is never checked
+	newBuff[0] &^= 1 << (63 - offset)
+
+	kr.bitStream = newBuff
+	kr.fuPos = int(offset)
+}
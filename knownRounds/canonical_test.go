@@ -0,0 +1,185 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package knownRounds
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Tests that KnownRounds.Clone returns a copy that matches the original and
+// does not share memory with it.
+func TestKnownRounds_Clone(t *testing.T) {
+	kr := NewGrowableKnownRound(128, 1024)
+	kr.Check(5)
+	kr.Check(70)
+
+	clone := kr.Clone()
+	if !reflect.DeepEqual(kr, clone) {
+		t.Errorf("Clone does not match original.\nexpected: %+v\nreceived: %+v",
+			kr, clone)
+	}
+
+	clone.Check(100)
+	if kr.Checked(100) {
+		t.Errorf("Checking a round in the clone modified the original.")
+	}
+}
+
+// Tests that KnownRounds.Equal returns true for KnownRounds with the same
+// check state but different capacities, positions, and stale data, and false
+// when the state of a single round differs.
+func TestKnownRounds_Equal(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 200; i++ {
+		kr := makeRandomKnownRounds(prng)
+
+		// Same state in a smaller buffer
+		other, err := kr.Slice(kr.firstUnchecked, kr.lastChecked)
+		if err != nil {
+			t.Fatalf("Failed to slice (%d): %+v", i, err)
+		}
+
+		if !kr.Equal(rotateKnownRounds(kr, 1)) {
+			t.Fatalf("Rotated KnownRounds is not equal (%d).", i)
+		}
+
+		if !kr.Equal(other) || !other.Equal(kr) {
+			t.Fatalf("KnownRounds with the same state are not equal (%d)."+
+				"\nkr:    %+v\nother: %+v", i, kr, other)
+		}
+
+		// Flip the state of one round in or around the window
+		rid := kr.firstUnchecked + id.Round(prng.Intn(kr.Len()))
+		if kr.Checked(rid) {
+			if err := other.Uncheck(rid); err != nil {
+				t.Fatalf("Failed to uncheck round %d (%d): %+v", rid, i, err)
+			}
+		} else {
+			other.ForceCheck(rid)
+		}
+
+		if kr.Checked(rid) != other.Checked(rid) && kr.Equal(other) {
+			t.Errorf("KnownRounds with different state for round %d are "+
+				"equal (%d).\nkr:    %+v\nother: %+v", rid, i, kr, other)
+		}
+	}
+
+	var nilKr *KnownRounds
+	if !nilKr.Equal(nil) || nilKr.Equal(NewKnownRound(64)) ||
+		NewKnownRound(64).Equal(nil) {
+		t.Errorf("Equal returned the wrong result for nil KnownRounds.")
+	}
+}
+
+// Tests that KnownRounds.Equal treats the rounds between lastChecked and
+// firstUnchecked of a truncated KnownRounds as checked.
+func TestKnownRounds_Equal_Truncated(t *testing.T) {
+	kr := NewKnownRound(128)
+	kr.Check(100)
+	kr.Check(150)
+	kr = kr.Truncate(200)
+
+	forwarded := NewKnownRound(128)
+	forwarded.Forward(199)
+	if kr.Equal(forwarded) || forwarded.Equal(kr) {
+		t.Errorf("KnownRounds with different state for round %d are equal."+
+			"\nkr:    %+v\nother: %+v", 199, kr, forwarded)
+	}
+
+	truncated := kr.Truncate(300)
+	if kr.Equal(truncated) || truncated.Equal(kr) {
+		t.Errorf("KnownRounds with different state for round %d are equal."+
+			"\nkr:    %+v\nother: %+v", 250, kr, truncated)
+	}
+
+	same := NewKnownRound(64)
+	same.Forward(200)
+	if !kr.Equal(same) || !same.Equal(kr) {
+		t.Errorf("KnownRounds with the same state are not equal."+
+			"\nkr:    %+v\nother: %+v", kr, same)
+	}
+}
+
+// Tests that KnownRounds.Canonicalize does not change the check state of any
+// round, rotates firstUnchecked into the first block, and makes Marshal output
+// equal for KnownRounds with the same state.
+func TestKnownRounds_Canonicalize(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 200; i++ {
+		kr := makeRandomKnownRounds(prng)
+
+		// Same state with the ring rotated and stale bits outside of the
+		// window
+		other := rotateKnownRounds(kr, prng.Intn(len(kr.bitStream)))
+		for rid := other.lastChecked + 1; rid < other.firstUnchecked+
+			id.Round(other.Len()); rid++ {
+			if prng.Intn(2) == 0 {
+				other.bitStream.set(other.getBitStreamPos(rid))
+			}
+		}
+
+		canonical := kr.Clone()
+		canonical.Canonicalize()
+		other.Canonicalize()
+
+		if !canonical.Equal(kr) {
+			t.Fatalf("Canonicalize changed the check state (%d)."+
+				"\nexpected: %+v\nreceived: %+v", i, kr, canonical)
+		}
+
+		low := id.Round(0)
+		if kr.firstUnchecked > 100 {
+			low = kr.firstUnchecked - 100
+		}
+		for rid := low; rid < kr.lastChecked+100; rid++ {
+			if kr.Checked(rid) != canonical.Checked(rid) {
+				t.Fatalf("Round %d has incorrect state (%d).\nexpected: %t"+
+					"\nreceived: %t", rid, i, kr.Checked(rid),
+					canonical.Checked(rid))
+			}
+		}
+
+		if canonical.fuPos != int(canonical.firstUnchecked%64) {
+			t.Errorf("fuPos %d not in first block for firstUnchecked %d (%d).",
+				canonical.fuPos, canonical.firstUnchecked, i)
+		}
+
+		if !bytes.Equal(canonical.Marshal(), other.Marshal()) {
+			t.Errorf("Canonical KnownRounds with the same state marshal "+
+				"differently (%d).\nexpected: %v\nreceived: %v",
+				i, canonical.Marshal(), other.Marshal())
+		}
+
+		// Checking the same round in both must give the same state
+		rid := kr.lastChecked + id.Round(prng.Intn(kr.Len()/2))
+		kr.ForceCheck(rid)
+		canonical.ForceCheck(rid)
+		if !kr.Equal(canonical) {
+			t.Errorf("Check after Canonicalize produced a different state "+
+				"(%d).\nexpected: %+v\nreceived: %+v", i, kr, canonical)
+		}
+	}
+}
+
+// rotateKnownRounds returns a copy of the KnownRounds with the blocks of the
+// ring buffer rotated by the given number of blocks.
+func rotateKnownRounds(kr *KnownRounds, blocks int) *KnownRounds {
+	rotated := kr.Clone()
+	for i := range kr.bitStream {
+		rotated.bitStream[(i+blocks)%len(kr.bitStream)] = kr.bitStream[i]
+	}
+	rotated.fuPos = (kr.fuPos + blocks*64) % kr.Len()
+	return rotated
+}
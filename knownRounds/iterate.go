@@ -0,0 +1,88 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package knownRounds
+
+import (
+	"math/bits"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// RangeFunc is called for each run of rounds from start (inclusive) to end
+// (exclusive). Returning false stops the iteration.
+type RangeFunc func(start, end id.Round) bool
+
+// Iterate calls fn for each run of consecutive checked rounds between
+// firstUnchecked and lastChecked, in order. The bit stream is read a word at a
+// time, so the cost of the iteration is proportional to the number of words in
+// the window and the number of runs rather than the number of rounds.
+func (kr *KnownRounds) Iterate(fn RangeFunc) {
+	kr.iterateRuns(true, fn)
+}
+
+// IterateUnchecked calls fn for each run of consecutive unchecked rounds
+// between firstUnchecked and lastChecked, in order. Rounds after lastChecked
+// are not included.
+func (kr *KnownRounds) IterateUnchecked(fn RangeFunc) {
+	kr.iterateRuns(false, fn)
+}
+
+// iterateRuns calls fn for each run of rounds between firstUnchecked and
+// lastChecked whose checked state matches checked.
+func (kr *KnownRounds) iterateRuns(checked bool, fn RangeFunc) {
+	if kr.lastChecked < kr.firstUnchecked || len(kr.bitStream) == 0 {
+		return
+	}
+
+	var runStart id.Round
+	inRun := false
+	for rid := kr.firstUnchecked; ; rid += 64 {
+		word := kr.getWord(rid)
+		if !checked {
+			word = ^word
+		}
+
+		// Only look at the bits up to lastChecked
+		last := kr.lastChecked-rid < 64
+		if last {
+			word &= ^(ones >> uint(kr.lastChecked-rid+1))
+		}
+
+		for pos := 0; pos < 64; {
+			if inRun {
+				// Find the end of the run, which is the next cleared bit
+				n := bits.LeadingZeros64(^(word << uint(pos)))
+				if pos+n >= 64 {
+					break
+				}
+				pos += n
+				inRun = false
+				if !fn(runStart, rid+id.Round(pos)) {
+					return
+				}
+			} else {
+				// Find the start of the next run, which is the next set bit
+				n := bits.LeadingZeros64(word << uint(pos))
+				if pos+n >= 64 {
+					break
+				}
+				pos += n
+				inRun = true
+				runStart = rid + id.Round(pos)
+			}
+		}
+
+		if last {
+			break
+		}
+	}
+
+	if inRun {
+		fn(runStart, kr.lastChecked+1)
+	}
+}
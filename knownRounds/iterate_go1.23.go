@@ -0,0 +1,44 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build go1.23
+
+package knownRounds
+
+import (
+	"iter"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// CheckedRounds returns an iterator over every checked round between
+// firstUnchecked and lastChecked, in order. See KnownRounds.Iterate.
+func (kr *KnownRounds) CheckedRounds() iter.Seq[id.Round] {
+	return func(yield func(id.Round) bool) {
+		kr.Iterate(yieldRange(yield))
+	}
+}
+
+// UncheckedRounds returns an iterator over every unchecked round between
+// firstUnchecked and lastChecked, in order. See KnownRounds.IterateUnchecked.
+func (kr *KnownRounds) UncheckedRounds() iter.Seq[id.Round] {
+	return func(yield func(id.Round) bool) {
+		kr.IterateUnchecked(yieldRange(yield))
+	}
+}
+
+// yieldRange returns a RangeFunc that yields every round in each range.
+func yieldRange(yield func(id.Round) bool) RangeFunc {
+	return func(start, end id.Round) bool {
+		for rid := start; rid < end; rid++ {
+			if !yield(rid) {
+				return false
+			}
+		}
+		return true
+	}
+}
@@ -0,0 +1,61 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+//go:build go1.23
+
+package knownRounds
+
+import (
+	"math/rand"
+	"testing"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Tests that KnownRounds.CheckedRounds and KnownRounds.UncheckedRounds yield
+// every round in the window in order with the correct check state.
+func TestKnownRounds_CheckedRounds_UncheckedRounds(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 50; i++ {
+		kr := makeRandomKnownRounds(prng)
+
+		var checked, unchecked []id.Round
+		for rid := kr.firstUnchecked; rid <= kr.lastChecked; rid++ {
+			if kr.Checked(rid) {
+				checked = append(checked, rid)
+			} else {
+				unchecked = append(unchecked, rid)
+			}
+		}
+
+		n := 0
+		for rid := range kr.CheckedRounds() {
+			if n >= len(checked) || checked[n] != rid {
+				t.Fatalf("CheckedRounds yielded unexpected round %d (%d).",
+					rid, i)
+			}
+			n++
+		}
+		if n != len(checked) {
+			t.Errorf("CheckedRounds yielded %d rounds, expected %d (%d).",
+				n, len(checked), i)
+		}
+
+		n = 0
+		for rid := range kr.UncheckedRounds() {
+			if n >= len(unchecked) || unchecked[n] != rid {
+				t.Fatalf("UncheckedRounds yielded unexpected round %d (%d).",
+					rid, i)
+			}
+			n++
+			if n == 3 {
+				break
+			}
+		}
+	}
+}
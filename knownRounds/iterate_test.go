@@ -0,0 +1,127 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package knownRounds
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Tests that KnownRounds.Iterate and KnownRounds.IterateUnchecked return the
+// expected ranges.
+func TestKnownRounds_Iterate(t *testing.T) {
+	kr := &KnownRounds{
+		bitStream:      uint64Buff{0, math.MaxUint64, 0, math.MaxUint64, 0},
+		firstUnchecked: 75,
+		lastChecked:    200,
+		fuPos:          11,
+	}
+
+	// Positions 64-127 and 192-255 are set, which are rounds 128-191 and
+	// 256-319
+	expectedChecked := [][2]id.Round{{128, 192}}
+	expectedUnchecked := [][2]id.Round{{75, 128}, {192, 201}}
+
+	var checked, unchecked [][2]id.Round
+	kr.Iterate(func(start, end id.Round) bool {
+		checked = append(checked, [2]id.Round{start, end})
+		return true
+	})
+	kr.IterateUnchecked(func(start, end id.Round) bool {
+		unchecked = append(unchecked, [2]id.Round{start, end})
+		return true
+	})
+
+	if !reflect.DeepEqual(expectedChecked, checked) {
+		t.Errorf("Iterate returned unexpected ranges."+
+			"\nexpected: %v\nreceived: %v", expectedChecked, checked)
+	}
+
+	if !reflect.DeepEqual(expectedUnchecked, unchecked) {
+		t.Errorf("IterateUnchecked returned unexpected ranges."+
+			"\nexpected: %v\nreceived: %v", expectedUnchecked, unchecked)
+	}
+}
+
+// Tests that KnownRounds.Iterate and KnownRounds.IterateUnchecked together
+// cover every round in the window exactly once and match KnownRounds.Checked
+// for randomly generated KnownRounds.
+func TestKnownRounds_Iterate_Random(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 200; i++ {
+		kr := makeRandomKnownRounds(prng)
+		seen := make(map[id.Round]bool)
+
+		check := func(expected bool) RangeFunc {
+			var prevEnd id.Round
+			return func(start, end id.Round) bool {
+				if start >= end || (prevEnd != 0 && start <= prevEnd) {
+					t.Fatalf("Invalid or non-maximal range [%d, %d) after "+
+						"%d (%d).", start, end, prevEnd, i)
+				}
+				prevEnd = end
+				for rid := start; rid < end; rid++ {
+					if seen[rid] || kr.Checked(rid) != expected {
+						t.Fatalf("Round %d incorrectly reported (%d).", rid, i)
+					}
+					seen[rid] = true
+				}
+				return true
+			}
+		}
+
+		kr.Iterate(check(true))
+		kr.IterateUnchecked(check(false))
+
+		for rid := kr.firstUnchecked; rid <= kr.lastChecked; rid++ {
+			if !seen[rid] {
+				t.Fatalf("Round %d not reported (%d).", rid, i)
+			}
+		}
+	}
+}
+
+// Tests that KnownRounds.Iterate stops when the RangeFunc returns false.
+func TestKnownRounds_Iterate_Stop(t *testing.T) {
+	kr := &KnownRounds{
+		bitStream:      uint64Buff{0xAAAAAAAAAAAAAAAA},
+		firstUnchecked: 1,
+		lastChecked:    63,
+		fuPos:          1,
+	}
+
+	var count int
+	kr.Iterate(func(start, end id.Round) bool {
+		count++
+		return count < 3
+	})
+
+	if count != 3 {
+		t.Errorf("Iterate did not stop.\nexpected: %d\nreceived: %d", 3, count)
+	}
+}
+
+// Benchmarks iterating over the unchecked rounds of a sparsely checked window
+// of 1M rounds.
+func BenchmarkKnownRounds_IterateUnchecked(b *testing.B) {
+	prng := rand.New(rand.NewSource(42))
+	kr := NewKnownRound(1 << 20)
+	for i := 0; i < 1000; i++ {
+		kr.Check(id.Round(prng.Intn(1 << 20)))
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		kr.IterateUnchecked(func(start, end id.Round) bool { return true })
+	}
+}
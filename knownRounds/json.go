@@ -0,0 +1,153 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package knownRounds
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// knownRoundsJSON is the human-readable JSON representation of KnownRounds.
+// Checked is the list of checked rounds between FirstUnchecked and LastChecked
+// in the format returned by KnownRounds.String.
+type knownRoundsJSON struct {
+	FirstUnchecked id.Round `json:"firstUnchecked"`
+	LastChecked    id.Round `json:"lastChecked"`
+	Checked        string   `json:"checked"`
+}
+
+// String returns the checked rounds between firstUnchecked and lastChecked as a
+// comma-separated list of rounds and inclusive round ranges (e.g.,
+// "100-150,152,160-170"). All rounds before firstUnchecked are checked and are
+// not included. This functions satisfies the fmt.Stringer interface.
+func (kr *KnownRounds) String() string {
+	var sb strings.Builder
+	kr.Iterate(func(start, end id.Round) bool {
+		if sb.Len() > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(strconv.FormatUint(uint64(start), 10))
+		if end-1 > start {
+			sb.WriteByte('-')
+			sb.WriteString(strconv.FormatUint(uint64(end-1), 10))
+		}
+		return true
+	})
+
+	return sb.String()
+}
+
+// MarshalJSON marshals the KnownRounds into a human-readable JSON object
+// containing the first unchecked round, the last checked round, and the list of
+// checked rounds between them. This function adheres to the json.Marshaler
+// interface.
+func (kr *KnownRounds) MarshalJSON() ([]byte, error) {
+	return json.Marshal(knownRoundsJSON{
+		FirstUnchecked: kr.firstUnchecked,
+		LastChecked:    kr.lastChecked,
+		Checked:        kr.String(),
+	})
+}
+
+// UnmarshalJSON unmarshalls the JSON object produced by MarshalJSON into the
+// KnownRounds. Like Unmarshal, the existing bit stream is reused if it is large
+// enough; otherwise, an error is returned unless the KnownRounds has no bit
+// stream or can grow to fit the data. This function adheres to the
+// json.Unmarshaler interface.
+func (kr *KnownRounds) UnmarshalJSON(data []byte) error {
+	var krj knownRoundsJSON
+	if err := json.Unmarshal(data, &krj); err != nil {
+		return err
+	}
+
+	ranges, err := parseRangeList(krj.Checked)
+	if err != nil {
+		return errors.Wrap(ErrCorruptEncoding, err.Error())
+	}
+
+	// Calculate the number of blocks needed to hold the rounds. firstUnchecked
+	// may be more than one after lastChecked, as Truncate produces.
+	fuPos := int(krj.FirstUnchecked % 64)
+	numBlocks := 1
+	if krj.LastChecked > krj.FirstUnchecked {
+		if uint64(krj.LastChecked-krj.FirstUnchecked) >= MaxUnmarshalBlocks*64 {
+			return errors.Wrapf(ErrCorruptEncoding, "rounds %d to %d exceed "+
+				"maximum of %d blocks", krj.FirstUnchecked, krj.LastChecked,
+				MaxUnmarshalBlocks)
+		}
+		numBlocks = (fuPos+int(krj.LastChecked-krj.FirstUnchecked))/64 + 1
+	}
+
+	bitStream := make(uint64Buff, numBlocks)
+	for _, r := range ranges {
+		if r[0] < krj.FirstUnchecked || r[1] > krj.LastChecked {
+			return errors.Wrapf(ErrCorruptEncoding, "checked rounds %d to %d "+
+				"outside of rounds %d to %d", r[0], r[1], krj.FirstUnchecked,
+				krj.LastChecked)
+		}
+		bitStream.setRange(fuPos+int(r[0]-krj.FirstUnchecked),
+			fuPos+int(r[1]-krj.FirstUnchecked)+1)
+	}
+
+	// Handle the copying in of the bit stream
+	if len(kr.bitStream) == 0 ||
+		(len(kr.bitStream) < numBlocks && kr.maxBlocks >= numBlocks) {
+		kr.bitStream = bitStream
+	} else if len(kr.bitStream) >= numBlocks {
+		kr.bitStream.clearAll()
+		copy(kr.bitStream, bitStream)
+	} else {
+		return errors.Errorf("KnownRounds bitStream size of %d is too small "+
+			"for passed in bit stream of size %d.",
+			len(kr.bitStream), numBlocks)
+	}
+
+	kr.firstUnchecked = krj.FirstUnchecked
+	kr.lastChecked = krj.LastChecked
+	kr.fuPos = fuPos
+
+	return nil
+}
+
+// parseRangeList parses a list of rounds and round ranges in the format
+// returned by KnownRounds.String. Each returned range is inclusive.
+func parseRangeList(s string) ([][2]id.Round, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	parts := strings.Split(s, ",")
+	ranges := make([][2]id.Round, len(parts))
+	for i, part := range parts {
+		startStr, endStr, isRange := strings.Cut(part, "-")
+		start, err := strconv.ParseUint(startStr, 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid round %q: %+v", startStr, err)
+		}
+
+		end := start
+		if isRange {
+			end, err = strconv.ParseUint(endStr, 10, 64)
+			if err != nil {
+				return nil, errors.Errorf("invalid round %q: %+v", endStr, err)
+			} else if end < start {
+				return nil, errors.Errorf("invalid range %q: end before start",
+					part)
+			}
+		}
+
+		ranges[i] = [2]id.Round{id.Round(start), id.Round(end)}
+	}
+
+	return ranges, nil
+}
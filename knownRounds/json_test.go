@@ -0,0 +1,164 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package knownRounds
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// Tests that KnownRounds.String returns the expected range list.
+func TestKnownRounds_String(t *testing.T) {
+	testData := []struct {
+		kr       *KnownRounds
+		expected string
+	}{{
+		kr: &KnownRounds{
+			bitStream:      uint64Buff{0, math.MaxUint64, 0, math.MaxUint64, 0},
+			firstUnchecked: 75,
+			lastChecked:    200,
+			fuPos:          11,
+		},
+		expected: "128-191",
+	}, {
+		kr: &KnownRounds{
+			bitStream:      uint64Buff{0x0000000005FFFFFF, 0xFFFFFFF000000008},
+			firstUnchecked: 100,
+			lastChecked:    188,
+			fuPos:          36,
+		},
+		expected: "101,103-155,188",
+	}, {
+		kr:       NewKnownRound(64),
+		expected: "",
+	}}
+
+	for i, data := range testData {
+		if s := data.kr.String(); s != data.expected {
+			t.Errorf("String returned unexpected range list (%d)."+
+				"\nexpected: %q\nreceived: %q", i, data.expected, s)
+		}
+	}
+}
+
+// Tests that KnownRounds.MarshalJSON returns the expected JSON.
+func TestKnownRounds_MarshalJSON(t *testing.T) {
+	kr := &KnownRounds{
+		bitStream:      uint64Buff{0, math.MaxUint64, 0, math.MaxUint64, 0},
+		firstUnchecked: 75,
+		lastChecked:    200,
+		fuPos:          11,
+	}
+	expected := `{"firstUnchecked":75,"lastChecked":200,"checked":"128-191"}`
+
+	data, err := json.Marshal(kr)
+	if err != nil {
+		t.Fatalf("Failed to JSON marshal KnownRounds: %+v", err)
+	}
+
+	if string(data) != expected {
+		t.Errorf("MarshalJSON returned unexpected JSON."+
+			"\nexpected: %s\nreceived: %s", expected, data)
+	}
+}
+
+// Tests that a KnownRounds JSON marshalled and unmarshalled matches the
+// original.
+func TestKnownRounds_MarshalJSON_UnmarshalJSON(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 100; i++ {
+		kr := makeRandomKnownRounds(prng)
+
+		data, err := json.Marshal(kr)
+		if err != nil {
+			t.Fatalf("Failed to JSON marshal KnownRounds (%d): %+v", i, err)
+		}
+
+		// The window may need an extra block to align firstUnchecked
+		for _, newKR := range []*KnownRounds{{}, NewKnownRound(kr.Len() + 64)} {
+			if err = json.Unmarshal(data, newKR); err != nil {
+				t.Fatalf("Failed to JSON unmarshal KnownRounds (%d): %+v", i, err)
+			}
+
+			if kr.firstUnchecked != newKR.firstUnchecked ||
+				kr.lastChecked != newKR.lastChecked ||
+				kr.String() != newKR.String() {
+				t.Errorf("JSON unmarshalled KnownRounds does not match "+
+					"original (%d).\nexpected: %s\nreceived: %s", i, kr, newKR)
+			}
+		}
+	}
+}
+
+// Tests that a KnownRounds returned by Truncate, where firstUnchecked is more
+// than one after lastChecked, round-trips through MarshalJSON and
+// UnmarshalJSON.
+func TestKnownRounds_MarshalJSON_UnmarshalJSON_Truncated(t *testing.T) {
+	kr := NewKnownRound(256)
+	kr.Check(5)
+	kr.Check(10)
+	truncated := kr.Truncate(50)
+
+	data, err := json.Marshal(truncated)
+	if err != nil {
+		t.Fatalf("Failed to JSON marshal KnownRounds: %+v", err)
+	}
+
+	newKr := NewKnownRound(256)
+	if err = json.Unmarshal(data, newKr); err != nil {
+		t.Fatalf("Failed to JSON unmarshal KnownRounds: %+v", err)
+	}
+
+	if !truncated.Equal(newKr) {
+		t.Errorf("JSON unmarshalled KnownRounds does not match."+
+			"\nexpected: %s\nreceived: %s", truncated, newKr)
+	}
+
+	if newKr.firstUnchecked != 50 || newKr.lastChecked != 10 {
+		t.Errorf("Unexpected firstUnchecked and lastChecked."+
+			"\nexpected: %d, %d\nreceived: %d, %d",
+			50, 10, newKr.firstUnchecked, newKr.lastChecked)
+	}
+}
+
+// Error path: tests that KnownRounds.UnmarshalJSON returns ErrCorruptEncoding
+// for invalid range lists and out of range rounds.
+func TestKnownRounds_UnmarshalJSON_CorruptEncoding(t *testing.T) {
+	testData := []string{
+		`{"firstUnchecked":75,"lastChecked":200,"checked":"a"}`,
+		`{"firstUnchecked":75,"lastChecked":200,"checked":"100-"}`,
+		`{"firstUnchecked":75,"lastChecked":200,"checked":"150-100"}`,
+		`{"firstUnchecked":75,"lastChecked":200,"checked":"100,,105"}`,
+		`{"firstUnchecked":75,"lastChecked":200,"checked":"50-100"}`,
+		`{"firstUnchecked":75,"lastChecked":200,"checked":"100-201"}`,
+		`{"firstUnchecked":200,"lastChecked":75,"checked":"100"}`,
+		`{"firstUnchecked":0,"lastChecked":18446744073709551615,"checked":""}`,
+	}
+
+	for i, data := range testData {
+		err := json.Unmarshal([]byte(data), &KnownRounds{})
+		if !errors.Is(err, ErrCorruptEncoding) {
+			t.Errorf("UnmarshalJSON did not return the expected error (%d)."+
+				"\nexpected: %v\nreceived: %+v", i, ErrCorruptEncoding, err)
+		}
+	}
+}
+
+// Error path: tests that KnownRounds.UnmarshalJSON returns an error when the
+// existing bit stream is too small.
+func TestKnownRounds_UnmarshalJSON_SizeError(t *testing.T) {
+	data := `{"firstUnchecked":75,"lastChecked":200,"checked":"128-191"}`
+	if err := json.Unmarshal([]byte(data), NewKnownRound(64)); err == nil {
+		t.Errorf("UnmarshalJSON did not return an error when the bit stream " +
+			"is too small.")
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"math"
+	"math/bits"
 
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
@@ -20,6 +21,18 @@ import (
 	"gitlab.com/xx_network/primitives/id"
 )
 
+// Errors returned by the error-returning KnownRounds functions. Returned errors
+// wrap these and can be tested for with errors.Is.
+var (
+	// ErrOutOfScope is returned when checking a round that is too far from the
+	// last checked round to fit in the bit stream.
+	ErrOutOfScope = errors.New("round outside the current scope")
+
+	// ErrCorruptEncoding is returned when unmarshalling data that is truncated
+	// or otherwise malformed.
+	ErrCorruptEncoding = errors.New("corrupt KnownRounds encoding")
+)
+
 type RoundCheckFunc func(id id.Round) bool
 
 // KnownRounds structure tracks which rounds are known and which are unknown.
@@ -31,6 +44,10 @@ type KnownRounds struct {
 	firstUnchecked id.Round   // ID of the first round that us unchecked
 	lastChecked    id.Round   // ID of the last round that is checked
 	fuPos          int        // The bit position of firstUnchecked in bitStream
+
+	// Maximum number of blocks the bit stream can grow to. If it is not larger
+	// than the length of bitStream, then the buffer never grows.
+	maxBlocks int
 }
 
 // DiskKnownRounds structure is used to as an intermediary to marshal and
@@ -51,6 +68,16 @@ func NewKnownRound(roundCapacity int) *KnownRounds {
 	}
 }
 
+// NewGrowableKnownRound creates a new empty KnownRounds with a bit stream that
+// can hold the given number of rounds. Instead of panicking or discarding old
+// rounds when a round outside the current scope is checked, the bit stream
+// grows until it can hold maxRoundCapacity rounds.
+func NewGrowableKnownRound(roundCapacity, maxRoundCapacity int) *KnownRounds {
+	kr := NewKnownRound(roundCapacity)
+	kr.SetMaxCapacity(maxRoundCapacity)
+	return kr
+}
+
 // NewFromParts creates a new KnownRounds from the given firstUnchecked,
 // lastChecked, fuPos, and uint64 buffer.
 func NewFromParts(
@@ -63,14 +90,68 @@ func NewFromParts(
 	}
 }
 
+// Encoding selects the encoding of the bit stream used by MarshalWithOptions.
+type Encoding uint8
+
+const (
+	// EncodingAuto tries every version 2 encoding and uses the one with the
+	// smallest output. It never selects EncodingBitRun, so the output can be
+	// read by every version of this package that supports version 2.
+	EncodingAuto Encoding = iota
+
+	// Encoding1Byte, Encoding2Bytes, Encoding4Bytes, and Encoding8Bytes use
+	// the version 2 run-length encoding with the given word size. Encoding1Byte
+	// is the encoding used by Marshal.
+	Encoding1Byte
+	Encoding2Bytes
+	Encoding4Bytes
+	Encoding8Bytes
+
+	// EncodingBitRun uses the version 3 encoding, which stores the lengths of
+	// alternating runs of 0 and 1 bits as varints. Data using this encoding
+	// cannot be unmarshalled by versions of this package that only support
+	// version 2, so it is only used when selected explicitly.
+	EncodingBitRun
+)
+
+// MarshalOptions contains the options for KnownRounds.MarshalWithOptions.
+type MarshalOptions struct {
+	// Encoding is the encoding used for the bit stream. Defaults to
+	// EncodingAuto, which only selects version 2 encodings.
+	Encoding Encoding
+}
+
 // Marshal returns the JSON encoding of DiskKnownRounds, which contains the
 // compressed information from KnownRounds. The bit stream is compressed such
 // that the firstUnchecked occurs in the first block of the bit stream.
 func (kr *KnownRounds) Marshal() []byte {
-	// Calculate length of compressed bit stream.
+	return kr.marshal(kr.windowBitStream().marshal())
+}
+
+// MarshalWithOptions encodes the KnownRounds like Marshal, but with the bit
+// stream encoded using the encoding selected in the options. The output can be
+// read using Unmarshal. An error is returned if the encoding is not
+// recognized.
+func (kr *KnownRounds) MarshalWithOptions(opts MarshalOptions) ([]byte, error) {
+	bitStream, err := kr.windowBitStream().marshalEncoding(opts.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	return kr.marshal(bitStream), nil
+}
+
+// windowBitStream returns a copy of the blocks of the bit stream between
+// firstUnchecked and lastChecked, such that firstUnchecked occurs in the first
+// block.
+func (kr *KnownRounds) windowBitStream() uint64Buff {
+	// Calculate length of compressed bit stream. It must include the blocks
+	// containing both firstUnchecked and lastChecked.
 	startPos := kr.getBitStreamPos(kr.firstUnchecked)
-	endPos := kr.getBitStreamPos(kr.lastChecked)
-	length := kr.bitStream.delta(startPos, endPos)
+	length := 1
+	if kr.lastChecked > kr.firstUnchecked {
+		length = (startPos%64+int(kr.lastChecked-kr.firstUnchecked))/64 + 1
+	}
 
 	// Copy only the blocks between firstUnchecked and lastChecked to the stream
 	startBlock, _ := kr.bitStream.convertLoc(startPos)
@@ -79,6 +160,12 @@ func (kr *KnownRounds) Marshal() []byte {
 		bitStream[i] = kr.bitStream[(i+startBlock)%len(kr.bitStream)]
 	}
 
+	return bitStream
+}
+
+// marshal returns firstUnchecked and lastChecked followed by the marshalled bit
+// stream.
+func (kr *KnownRounds) marshal(bitStream []byte) []byte {
 	// Create new buffer
 	buf := bytes.Buffer{}
 
@@ -93,38 +180,84 @@ func (kr *KnownRounds) Marshal() []byte {
 	buf.Write(b)
 
 	// Add marshaled bitStream to buffer
-	buf.Write(bitStream.marshal())
+	buf.Write(bitStream)
 
 	return buf.Bytes()
 }
 
 // Unmarshal parses the JSON-encoded data and stores it in the KnownRounds. An
 // error is returned if the bit stream data is larger than the KnownRounds bit
-// stream.
+// stream. Malformed data returns an error wrapping ErrCorruptEncoding. On
+// error, the KnownRounds is left unmodified.
 func (kr *KnownRounds) Unmarshal(data []byte) error {
 	buf := bytes.NewBuffer(data)
 
 	if buf.Len() < 16 {
-		return errors.Errorf("KnownRounds Unmarshal: "+
+		return errors.Wrapf(ErrCorruptEncoding, "KnownRounds Unmarshal: "+
 			"size of data %d < %d expected", buf.Len(), 16)
 	}
 
 	// Get firstUnchecked and lastChecked and calculate fuPos
-	kr.firstUnchecked = id.Round(binary.LittleEndian.Uint64(buf.Next(8)))
-	kr.lastChecked = id.Round(binary.LittleEndian.Uint64(buf.Next(8)))
-	kr.fuPos = int(kr.firstUnchecked % 64)
+	firstUnchecked := id.Round(binary.LittleEndian.Uint64(buf.Next(8)))
+	lastChecked := id.Round(binary.LittleEndian.Uint64(buf.Next(8)))
+	fuPos := int(firstUnchecked % 64)
+
+	// Limit the size of the decoded bit stream to the size the KnownRounds can
+	// hold so that oversized data is rejected before it is allocated. One
+	// extra block is allowed for the streams written by older versions of
+	// Marshal, which are trimmed below.
+	maxBlocks := MaxUnmarshalBlocks
+	if len(kr.bitStream) > 0 {
+		limit := len(kr.bitStream)
+		if kr.maxBlocks > limit {
+			limit = kr.maxBlocks
+		}
+		if limit+1 < maxBlocks {
+			maxBlocks = limit + 1
+		}
+	}
 
 	// Unmarshal the bitStream from the rest of the bytes
-	bitStream, err := unmarshal(buf.Bytes())
+	bitStream, err := unmarshalLimit(buf.Bytes(), maxBlocks)
 	if err != nil {
-		return errors.Errorf("Failed to unmarshal bitstream: %+v", err)
+		return errors.Wrapf(ErrCorruptEncoding,
+			"Failed to unmarshal bitstream: %+v", err)
+	}
+
+	// Ensure the rounds between firstUnchecked and lastChecked fit in the
+	// bit stream. firstUnchecked may be more than one after lastChecked, as
+	// Truncate produces.
+	if len(bitStream) == 0 {
+		return errors.Wrap(ErrCorruptEncoding, "bit stream is empty")
+	} else if lastChecked >= firstUnchecked &&
+		uint64(lastChecked-firstUnchecked) >= uint64(len(bitStream)*64-fuPos) {
+		// Older versions of Marshal dropped the final block when lastChecked
+		// was on a block boundary, so pad a stream that is one block short
+		if uint64(lastChecked-firstUnchecked) >=
+			uint64((len(bitStream)+1)*64-fuPos) {
+			return errors.Wrapf(ErrCorruptEncoding, "rounds %d to %d do not "+
+				"fit in bit stream of size %d", firstUnchecked, lastChecked,
+				len(bitStream))
+		}
+		bitStream = append(bitStream, 0)
+	} else if lastChecked < firstUnchecked {
+		// No rounds from firstUnchecked onward are checked, so only the first
+		// block is needed. Older versions of Marshal wrote an extra block.
+		bitStream = bitStream[:1]
 	}
 
-	// Handle the copying in of the bit stream
+	// Handle the copying in of the bit stream. A new bit stream is copied into
+	// a buffer of the exact size so that any extra capacity left over from
+	// decoding or trimming is not kept.
 	if len(kr.bitStream) == 0 {
 		// If there is no bitstream, like in the wire representations, then make
 		// the size equal to what is coming in
-		kr.bitStream = bitStream
+		kr.bitStream = bitStream.deepCopy()
+	} else if len(kr.bitStream) < len(bitStream) &&
+		kr.maxBlocks >= len(bitStream) {
+		// If the buffer is allowed to grow to fit the data, then use the new
+		// size
+		kr.bitStream = bitStream.deepCopy()
 	} else if len(kr.bitStream) >= len(bitStream) {
 		// If a size already exists and the data fits within it, then copy it
 		// into the beginning of the buffer
@@ -137,6 +270,10 @@ func (kr *KnownRounds) Unmarshal(data []byte) error {
 			len(kr.bitStream), len(bitStream))
 	}
 
+	kr.firstUnchecked = firstUnchecked
+	kr.lastChecked = lastChecked
+	kr.fuPos = fuPos
+
 	return nil
 }
 
@@ -178,6 +315,22 @@ func (kr KnownRounds) MarshalBitStream2Byte() []byte { return kr.bitStream.marsh
 func (kr KnownRounds) MarshalBitStream4Byte() []byte { return kr.bitStream.marshal4BytesVer2() }
 func (kr KnownRounds) MarshalBitStream8Byte() []byte { return kr.bitStream.marshal8BytesVer2() }
 
+// SetMaxCapacity sets the maximum number of rounds the bit stream can grow to
+// hold. A capacity that is not larger than the current capacity disables
+// growth.
+func (kr *KnownRounds) SetMaxCapacity(maxRoundCapacity int) {
+	kr.maxBlocks = (maxRoundCapacity + 63) / 64
+}
+
+// MaxCapacity returns the maximum number of rounds the bit stream can grow to
+// hold. If growth is disabled, then the current capacity is returned.
+func (kr *KnownRounds) MaxCapacity() int {
+	if kr.maxBlocks > len(kr.bitStream) {
+		return kr.maxBlocks * 64
+	}
+	return kr.Len()
+}
+
 // Checked determines if the round has been checked.
 func (kr *KnownRounds) Checked(rid id.Round) bool {
 	if rid < kr.firstUnchecked {
@@ -193,23 +346,75 @@ func (kr *KnownRounds) Checked(rid id.Round) bool {
 
 // Check denotes a round has been checked. If the passed in round occurred after
 // the last checked round, then every round between them is set as unchecked and
-// the passed in round becomes the last checked round. Will panic if the buffer
-// is not large enough to hold the current data and the new data
+// the passed in round becomes the last checked round. If the buffer is not
+// large enough to hold the current data and the new data, then it grows up to
+// its maximum capacity. Will panic if the buffer is still not large enough.
 func (kr *KnownRounds) Check(rid id.Round) {
-	if abs(int(kr.lastChecked-rid))/(len(kr.bitStream)*64) > 0 {
+	if err := kr.TryCheck(rid); err != nil {
 		jww.FATAL.Panicf("Cannot check a round outside the current scope. " +
 			"Scope is KnownRounds size more rounds than last checked. A call " +
 			"to Forward can be used to fix the scope.")
 	}
+}
+
+// TryCheck denotes a round has been checked. It behaves like Check, except
+// that an error wrapping ErrOutOfScope is returned instead of panicking when
+// the buffer is not large enough to hold the current data and the new data.
+// The KnownRounds is not modified on error.
+func (kr *KnownRounds) TryCheck(rid id.Round) error {
+	if kr.maxBlocks > len(kr.bitStream) {
+		// Check that the round fits once the buffer has grown to its maximum
+		// capacity before growing it
+		if rid >= kr.firstUnchecked &&
+			uint64(rid-kr.firstUnchecked) >= uint64(kr.maxBlocks*64) {
+			return errors.Wrapf(ErrOutOfScope, "cannot check round %d with "+
+				"first unchecked round %d and max buffer size %d",
+				rid, kr.firstUnchecked, kr.maxBlocks*64)
+		}
+
+		kr.grow(rid)
+		kr.check(rid)
+		return nil
+	}
+
+	distance := uint64(kr.lastChecked - rid)
+	if rid > kr.lastChecked {
+		distance = uint64(rid - kr.lastChecked)
+	}
+
+	if distance >= uint64(kr.Len()) {
+		return errors.Wrapf(ErrOutOfScope, "cannot check round %d with last "+
+			"checked round %d and buffer size %d",
+			rid, kr.lastChecked, kr.Len())
+	}
+
 	kr.check(rid)
+	return nil
 }
 
+// ForceCheck denotes a round has been checked. If the buffer is not large
+// enough to hold the round, then it grows up to its maximum capacity. If it is
+// still not large enough, then the buffer is shifted forward, erasing old data.
 func (kr *KnownRounds) ForceCheck(rid id.Round) {
 	if rid < kr.firstUnchecked {
 		return
-	} else if kr.lastChecked < rid &&
-		int(rid-kr.firstUnchecked) > (len(kr.bitStream)*64) {
-		kr.Forward(rid - id.Round(len(kr.bitStream)*64))
+	} else if kr.maxBlocks <= len(kr.bitStream) {
+		// Buffers that cannot grow keep their original behaviour
+		if kr.lastChecked < rid &&
+			int(rid-kr.firstUnchecked) > (len(kr.bitStream)*64) {
+			kr.Forward(rid - id.Round(len(kr.bitStream)*64))
+		}
+		kr.check(rid)
+		return
+	}
+
+	kr.grow(rid)
+
+	// Once a growable buffer reaches its maximum capacity, shift it forward
+	// just enough to fit the round
+	if kr.lastChecked < rid &&
+		int(rid-kr.firstUnchecked) >= (len(kr.bitStream)*64) {
+		kr.Forward(rid + 1 - id.Round(len(kr.bitStream)*64))
 	}
 
 	kr.check(rid)
@@ -259,6 +464,52 @@ func (kr *KnownRounds) check(rid id.Round) {
 	kr.bitStream.set(pos)
 }
 
+// grow resizes the bit stream so that it can hold every round from
+// firstUnchecked to rid. The buffer at least doubles in size on each growth but
+// never grows larger than maxBlocks. The rounds in the buffer are rotated so
+// that firstUnchecked lies in the first block.
+func (kr *KnownRounds) grow(rid id.Round) {
+	if kr.maxBlocks <= len(kr.bitStream) || rid < kr.firstUnchecked ||
+		int(rid-kr.firstUnchecked) < kr.Len() {
+		return
+	}
+
+	// Calculate the number of blocks needed to fit the new round
+	numBlocks := kr.maxBlocks
+	if needed := uint64(rid-kr.firstUnchecked)/64 + 2; needed < uint64(numBlocks) {
+		numBlocks = int(needed)
+		if numBlocks < 2*len(kr.bitStream) {
+			numBlocks = 2 * len(kr.bitStream)
+		}
+		if numBlocks > kr.maxBlocks {
+			numBlocks = kr.maxBlocks
+		}
+	}
+
+	newBuff := make(uint64Buff, numBlocks)
+	if len(kr.bitStream) == 0 {
+		kr.bitStream = newBuff
+		kr.fuPos = int(kr.firstUnchecked % 64)
+		return
+	}
+
+	// Copy the blocks in order starting at the block containing firstUnchecked
+	startBlock, offset := kr.bitStream.convertLoc(kr.fuPos)
+	for i := range kr.bitStream {
+		newBuff[i] = kr.bitStream[kr.bitStream.getBin(startBlock+i)]
+	}
+
+	// The bits before fuPos in the first block are either before
+	// firstUnchecked or wrapped around past the end of the buffer; move them
+	// to the end of the old data
+	head := ^bitMaskRange(0, offset)
+	newBuff[len(kr.bitStream)] = newBuff[0] & head
+	newBuff[0] &^= head
+
+	kr.bitStream = newBuff
+	kr.fuPos = offset
+}
+
 // abs returns the absolute value of the passed in integer.
 func abs(n int) int {
 	if n < 0 {
@@ -267,21 +518,53 @@ func abs(n int) int {
 	return n
 }
 
-// migrateFirstUnchecked moves firstUnchecked to the next unchecked round or
-// sets it to lastUnchecked if all rounds are checked.
+// migrateFirstUnchecked moves firstUnchecked to the next unchecked round at or
+// after rid or sets it to the round after lastChecked if all rounds are
+// checked. The bit stream is scanned a word at a time; because the first round
+// of a block is its most significant bit, the next unchecked round is found by
+// counting the leading zeros of the inverted word.
 func (kr *KnownRounds) migrateFirstUnchecked(rid id.Round) {
-	for ; kr.bitStream.get(kr.getBitStreamPos(rid)) && rid <= kr.lastChecked; rid++ {
+	if rid > kr.lastChecked || len(kr.bitStream) == 0 {
+		kr.fuPos = kr.getBitStreamPos(rid)
+		kr.firstUnchecked = rid
+		return
+	}
+
+	pos := kr.getBitStreamPos(rid)
+	remaining := uint64(kr.lastChecked-rid) + 1
+	var skipped uint64
+	for skipped < remaining {
+		bin, offset := pos/64, pos%64
+		unchecked := ^kr.bitStream[bin] & (ones >> uint(offset))
+		if unchecked != 0 {
+			skipped += uint64(bits.LeadingZeros64(unchecked) - offset)
+			break
+		}
+
+		// Every round left in the block is checked; skip to the next block
+		skipped += uint64(64 - offset)
+		pos = kr.bitStream.getBin(bin+1) * 64
+	}
+
+	if skipped > remaining {
+		skipped = remaining
 	}
-	kr.fuPos = kr.getBitStreamPos(rid)
-	kr.firstUnchecked = rid
+
+	kr.fuPos = kr.getBitStreamPos(rid + id.Round(skipped))
+	kr.firstUnchecked = rid + id.Round(skipped)
 }
 
-// Forward sets all rounds before the given round ID as checked.
+// Forward sets all rounds before the given round ID as checked. If the round is
+// after lastChecked, then the block holding the new firstUnchecked is cleared,
+// since every round in it is either before firstUnchecked or unchecked.
 func (kr *KnownRounds) Forward(rid id.Round) {
 	if rid > kr.lastChecked {
 		kr.firstUnchecked = rid
 		kr.lastChecked = rid
 		kr.fuPos = int(rid % 64)
+		if len(kr.bitStream) > 0 {
+			kr.bitStream[0] = 0
+		}
 	} else if rid > kr.firstUnchecked {
 		kr.migrateFirstUnchecked(rid)
 	}
@@ -359,7 +642,9 @@ func (kr *KnownRounds) RangeUncheckedMasked(mask *KnownRounds,
 	kr.RangeUncheckedMaskedRange(mask, roundCheck, 0, math.MaxUint64, maxChecked)
 }
 
-// RangeUncheckedMaskedRange masks the bit stream with the provided mask.
+// RangeUncheckedMaskedRange masks the bit stream with the provided mask. The
+// mask is modified by this call; see CheckMaskedRange for a variant that does
+// not modify it.
 func (kr *KnownRounds) RangeUncheckedMaskedRange(mask *KnownRounds,
 	roundCheck RoundCheckFunc, start, end id.Round, maxChecked int) {
 
@@ -429,6 +714,7 @@ func (kr *KnownRounds) Truncate(start id.Round) *KnownRounds {
 		firstUnchecked: kr.firstUnchecked,
 		lastChecked:    kr.lastChecked,
 		fuPos:          kr.fuPos,
+		maxBlocks:      kr.maxBlocks,
 	}
 
 	newKr.migrateFirstUnchecked(start)
@@ -438,6 +724,16 @@ func (kr *KnownRounds) Truncate(start id.Round) *KnownRounds {
 
 // Get the position of the bit in the bit stream for the given round ID.
 func (kr *KnownRounds) getBitStreamPos(rid id.Round) int {
+	// Fast path for rounds in the buffer window, which avoids the modulo
+	n := kr.Len()
+	if rid >= kr.firstUnchecked && uint64(rid-kr.firstUnchecked) < uint64(n) {
+		pos := kr.fuPos + int(rid-kr.firstUnchecked)
+		if pos >= n {
+			pos -= n
+		}
+		return pos
+	}
+
 	var delta int
 	if rid < kr.firstUnchecked {
 		delta = -int(kr.firstUnchecked - rid)
@@ -9,12 +9,15 @@ package knownRounds
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"math"
 	"math/rand"
 	"reflect"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"gitlab.com/xx_network/primitives/id"
 )
@@ -161,23 +164,28 @@ func TestKnownRounds_OutputBuffChanges(t *testing.T) {
 		old     []uint64
 		changes KrChanges
 	}{{
-		current: KnownRounds{uint64Buff{}, 75, 320, 75},
+		current: KnownRounds{bitStream: uint64Buff{},
+			firstUnchecked: 75, lastChecked: 320, fuPos: 75},
 		old:     []uint64{},
 		changes: KrChanges{},
 	}, {
-		current: KnownRounds{uint64Buff{0, max, 0, max, 0}, 75, 320, 75},
+		current: KnownRounds{bitStream: uint64Buff{0, max, 0, max, 0},
+			firstUnchecked: 75, lastChecked: 320, fuPos: 75},
 		old:     []uint64{0, max, 0, max, 0},
 		changes: KrChanges{},
 	}, {
-		current: KnownRounds{uint64Buff{0, max, 0, max, 0}, 75, 320, 75},
+		current: KnownRounds{bitStream: uint64Buff{0, max, 0, max, 0},
+			firstUnchecked: 75, lastChecked: 320, fuPos: 75},
 		old:     []uint64{0, max, 0, max, 0},
 		changes: KrChanges{},
 	}, {
-		current: KnownRounds{uint64Buff{1, max, 0, max, 0}, 75, 320, 75},
+		current: KnownRounds{bitStream: uint64Buff{1, max, 0, max, 0},
+			firstUnchecked: 75, lastChecked: 320, fuPos: 75},
 		old:     []uint64{0, max, 0, max, 0},
 		changes: KrChanges{0: 1},
 	}, {
-		current: KnownRounds{uint64Buff{0, max, 0, max, 0}, 75, 320, 75},
+		current: KnownRounds{bitStream: uint64Buff{0, max, 0, max, 0},
+			firstUnchecked: 75, lastChecked: 320, fuPos: 75},
 		old:     []uint64{max, 0, max, 0, max},
 		changes: KrChanges{0: 0, 1: max, 2: 0, 3: max, 4: 0},
 	}}
@@ -221,11 +229,13 @@ func TestKnownRounds_OutputBuffChanges_IncorrectLengthError(t *testing.T) {
 		current KnownRounds
 		old     []uint64
 	}{{
-		current: KnownRounds{uint64Buff{0, max, 0, max, 0}, 75, 320, 75},
-		old:     []uint64{0, max, 0},
+		current: KnownRounds{bitStream: uint64Buff{0, max, 0, max, 0},
+			firstUnchecked: 75, lastChecked: 320, fuPos: 75},
+		old: []uint64{0, max, 0},
 	}, {
-		current: KnownRounds{uint64Buff{0, max, 0}, 75, 320, 75},
-		old:     []uint64{0, max, 0, max, 0},
+		current: KnownRounds{bitStream: uint64Buff{0, max, 0},
+			firstUnchecked: 75, lastChecked: 320, fuPos: 75},
+		old: []uint64{0, max, 0, max, 0},
 	}}
 
 	expectedErr := "not the same as length of the current buffer"
@@ -502,6 +512,57 @@ func TestKnownRounds_Forward_NewKR(t *testing.T) {
 	}
 }
 
+// Tests that KnownRounds.Forward past lastChecked clears stale bits so that the
+// new firstUnchecked round is unchecked.
+func TestKnownRounds_Forward_ClearsStaleBits(t *testing.T) {
+	kr := NewKnownRound(128)
+	for rid := id.Round(0); rid < 128; rid += 2 {
+		kr.Check(rid)
+	}
+
+	kr.Forward(258)
+	if kr.Checked(258) {
+		t.Errorf("Round %d is checked after forwarding to it.", 258)
+	}
+	if !kr.Checked(257) {
+		t.Errorf("Round %d before firstUnchecked is not checked.", 257)
+	}
+}
+
+// Tests that KnownRounds.migrateFirstUnchecked moves firstUnchecked to the
+// same round as scanning the bit stream one round at a time for random
+// KnownRounds and starting rounds.
+func TestKnownRounds_migrateFirstUnchecked(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 1000; i++ {
+		kr := makeRandomKnownRounds(prng)
+
+		// Fill random runs of the window so that whole blocks are skipped
+		for j := 0; j < prng.Intn(4); j++ {
+			start := kr.firstUnchecked + id.Round(prng.Intn(kr.Len()))
+			end := start + id.Round(prng.Intn(200))
+			for rid := start; rid <= end && rid <= kr.lastChecked; rid++ {
+				kr.bitStream.set(kr.getBitStreamPos(rid))
+			}
+		}
+
+		rid := kr.firstUnchecked + id.Round(prng.Intn(kr.Len()+10))
+		expected := rid
+		for ; expected <= kr.lastChecked &&
+			kr.bitStream.get(kr.getBitStreamPos(expected)); expected++ {
+		}
+		expectedPos := kr.getBitStreamPos(expected)
+
+		kr.migrateFirstUnchecked(rid)
+		if kr.firstUnchecked != expected || kr.fuPos != expectedPos {
+			t.Errorf("Unexpected firstUnchecked after migrating from %d (%d)."+
+				"\nexpected: %d (pos %d)\nreceived: %d (pos %d)", rid, i,
+				expected, expectedPos, kr.firstUnchecked, kr.fuPos)
+		}
+	}
+}
+
 // Test happy path of KnownRounds.RangeUnchecked.
 func TestKnownRounds_RangeUnchecked(t *testing.T) {
 	// Generate test round IDs and expected buffers
@@ -867,6 +928,28 @@ func TestKnownRounds_Truncate_Wrap_Around(t *testing.T) {
 	}
 }
 
+// Tests that the KnownRounds returned by KnownRounds.Truncate keeps the
+// maximum capacity of a growable KnownRounds and can grow like the original.
+func TestKnownRounds_Truncate_Growable(t *testing.T) {
+	kr := NewGrowableKnownRound(64, 512)
+	kr.Check(5)
+	kr.Check(10)
+
+	newKR := kr.Truncate(11)
+	if newKR.MaxCapacity() != kr.MaxCapacity() {
+		t.Errorf("Truncated KnownRounds has a different maximum capacity."+
+			"\nexpected: %d\nreceived: %d", kr.MaxCapacity(),
+			newKR.MaxCapacity())
+	}
+
+	if err := newKR.TryCheck(400); err != nil {
+		t.Fatalf("TryCheck failed on truncated KnownRounds: %+v", err)
+	}
+	if !newKR.Checked(400) || newKR.Checked(399) {
+		t.Errorf("Unexpected rounds checked after TryCheck: %s", newKR)
+	}
+}
+
 // Simulate saving and reading from the database by:
 // 1. make random edits to the KnownRounds
 // 2. save after each random edit (KnownRounds.OutputBuffChanges)
@@ -944,3 +1027,614 @@ func TestKnownRounds_Len(t *testing.T) {
 		t.Errorf("Failed to unmarshal: %+v", err)
 	}
 }
+
+// Tests that NewGrowableKnownRound creates a KnownRounds with the expected
+// initial and maximum capacity.
+func TestNewGrowableKnownRound(t *testing.T) {
+	kr := NewGrowableKnownRound(64, 640)
+
+	if kr.Len() != 64 {
+		t.Errorf("Unexpected capacity.\nexpected: %d\nreceived: %d",
+			64, kr.Len())
+	}
+
+	if kr.MaxCapacity() != 640 {
+		t.Errorf("Unexpected max capacity.\nexpected: %d\nreceived: %d",
+			640, kr.MaxCapacity())
+	}
+
+	kr.SetMaxCapacity(0)
+	if kr.MaxCapacity() != 64 {
+		t.Errorf("Max capacity should equal capacity when growth is "+
+			"disabled.\nexpected: %d\nreceived: %d", 64, kr.MaxCapacity())
+	}
+}
+
+// Tests that checking rounds outside the scope of a growable KnownRounds grows
+// the buffer without losing any check state.
+func TestKnownRounds_Check_Grow(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 50; i++ {
+		kr := NewGrowableKnownRound(64, 64*64)
+		checked := make(map[id.Round]bool)
+
+		// Start at a random offset so that fuPos is not block aligned
+		start := id.Round(prng.Intn(500))
+		kr.Forward(start)
+
+		for j := 0; j < 200; j++ {
+			rid := start + id.Round(prng.Intn(1+j*15))
+			kr.Check(rid)
+			checked[rid] = true
+		}
+
+		if kr.Len() > 64*64 {
+			t.Errorf("Buffer grew past its max capacity (%d)."+
+				"\nexpected: %d\nreceived: %d", i, 64*64, kr.Len())
+		}
+
+		for rid := start; rid <= kr.lastChecked; rid++ {
+			if kr.Checked(rid) != checked[rid] {
+				t.Fatalf("Round %d has incorrect check state (%d)."+
+					"\nexpected: %t\nreceived: %t",
+					rid, i, checked[rid], kr.Checked(rid))
+			}
+		}
+
+		if kr.firstUnchecked != kr.lastChecked+1 && checked[kr.firstUnchecked] {
+			t.Errorf("firstUnchecked %d is checked (%d).",
+				kr.firstUnchecked, i)
+		}
+
+		if kr.getBitStreamPos(kr.firstUnchecked) != kr.fuPos {
+			t.Errorf("fuPos inconsistent with firstUnchecked (%d)."+
+				"\nexpected: %d\nreceived: %d",
+				i, kr.getBitStreamPos(kr.firstUnchecked), kr.fuPos)
+		}
+	}
+}
+
+// Tests that a growable KnownRounds wrapped around its ring buffer keeps its
+// check state when it grows.
+func TestKnownRounds_Check_GrowWrapped(t *testing.T) {
+	kr := &KnownRounds{
+		bitStream:      uint64Buff{0xF0F0F0F0F0F0F0F0, 0xAAAAAAAAAAAAAAAA},
+		firstUnchecked: 1000,
+		lastChecked:    1000 + 127,
+		fuPos:          68,
+		maxBlocks:      16,
+	}
+
+	expected := make(map[id.Round]bool)
+	for rid := kr.firstUnchecked; rid <= kr.lastChecked; rid++ {
+		expected[rid] = kr.Checked(rid)
+	}
+
+	kr.Check(kr.lastChecked + 500)
+	expected[kr.lastChecked] = true
+
+	if kr.Len() < 128+500 {
+		t.Errorf("Buffer did not grow.\nexpected: >= %d\nreceived: %d",
+			128+500, kr.Len())
+	}
+
+	for rid := id.Round(1000); rid <= kr.lastChecked; rid++ {
+		if kr.Checked(rid) != expected[rid] {
+			t.Errorf("Round %d has incorrect check state."+
+				"\nexpected: %t\nreceived: %t",
+				rid, expected[rid], kr.Checked(rid))
+		}
+	}
+}
+
+// Error path: Tests that Check panics on a growable KnownRounds when the round
+// does not fit in the buffer at its maximum capacity.
+func TestKnownRounds_Check_GrowMaxCapacity(t *testing.T) {
+	kr := NewGrowableKnownRound(64, 256)
+	kr.Check(5)
+	kr.Check(10)
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("Check did not panic at max capacity.")
+		}
+	}()
+
+	kr.Check(1000)
+}
+
+// Error path: Tests that TryCheck on a growable KnownRounds returns an error
+// wrapping ErrOutOfScope and does not modify the KnownRounds when the round
+// does not fit in the buffer at its maximum capacity, and that it succeeds for
+// the last round that fits.
+func TestKnownRounds_TryCheck_GrowMaxCapacity(t *testing.T) {
+	kr := NewGrowableKnownRound(64, 256)
+	kr.Check(5)
+	kr.Check(10)
+	expected := kr.Clone()
+
+	for _, rid := range []id.Round{256, 1000} {
+		if err := kr.TryCheck(rid); !errors.Is(err, ErrOutOfScope) {
+			t.Errorf("TryCheck did not return the expected error for round "+
+				"%d.\nexpected: %v\nreceived: %+v", rid, ErrOutOfScope, err)
+		}
+	}
+	if !reflect.DeepEqual(expected, kr) {
+		t.Errorf("TryCheck modified the KnownRounds on error."+
+			"\nexpected: %+v\nreceived: %+v", expected, kr)
+	}
+
+	if err := kr.TryCheck(255); err != nil {
+		t.Fatalf("TryCheck returned an error: %+v", err)
+	}
+	if kr.Len() != 256 {
+		t.Errorf("Unexpected capacity.\nexpected: %d\nreceived: %d",
+			256, kr.Len())
+	}
+	for _, rid := range []id.Round{5, 10, 255} {
+		if !kr.Checked(rid) {
+			t.Errorf("Round %d not checked.", rid)
+		}
+	}
+	if kr.Checked(0) || kr.Checked(6) || kr.Checked(11) {
+		t.Errorf("Unchecked rounds lost after growth.")
+	}
+}
+
+// Tests that a growable KnownRounds can unmarshal data larger than its current
+// buffer.
+func TestKnownRounds_Unmarshal_Grow(t *testing.T) {
+	kr := NewGrowableKnownRound(64, 64*16)
+	kr.Check(3)
+	kr.Check(500)
+
+	newKR := NewGrowableKnownRound(64, 64*16)
+	if err := newKR.Unmarshal(kr.Marshal()); err != nil {
+		t.Fatalf("Unmarshal produced an error: %+v", err)
+	}
+
+	for rid := id.Round(0); rid <= 501; rid++ {
+		if kr.Checked(rid) != newKR.Checked(rid) {
+			t.Errorf("Round %d has incorrect check state."+
+				"\nexpected: %t\nreceived: %t",
+				rid, kr.Checked(rid), newKR.Checked(rid))
+		}
+	}
+}
+
+// Tests that KnownRounds.ForceCheck on a buffer that cannot grow shifts the
+// buffer forward the same way it did before growable buffers were added.
+func TestKnownRounds_ForceCheck_FixedBuffer(t *testing.T) {
+	kr := NewKnownRound(128)
+	kr.Forward(1000)
+	kr.Check(1001)
+	kr.Check(1003)
+	kr.Check(1100)
+	kr.ForceCheck(1200)
+
+	if kr.firstUnchecked != 1201 || kr.lastChecked != 1201 {
+		t.Errorf("Unexpected firstUnchecked and lastChecked."+
+			"\nexpected: %d, %d\nreceived: %d, %d",
+			1201, 1201, kr.firstUnchecked, kr.lastChecked)
+	}
+
+	if !kr.Checked(1101) {
+		t.Errorf("Round %d should be checked.", 1101)
+	}
+}
+
+// Tests that KnownRounds.ForceCheck on a growable buffer at its maximum
+// capacity keeps the most recent rounds when checking a round exactly one
+// buffer length past firstUnchecked.
+func TestKnownRounds_ForceCheck_FullGrowableBuffer(t *testing.T) {
+	kr := NewGrowableKnownRound(128, 256)
+	kr.Check(5)
+	kr.ForceCheck(1000)
+
+	if kr.Len() != 256 {
+		t.Errorf("Buffer did not grow to its maximum capacity: %d", kr.Len())
+	}
+
+	if kr.lastChecked != 1000 || !kr.Checked(1000) {
+		t.Errorf("Round %d not checked. lastChecked: %d", 1000, kr.lastChecked)
+	}
+
+	if kr.Checked(1000 - 255) {
+		t.Errorf("Round %d should not be checked.", 1000-255)
+	}
+}
+
+// Tests that KnownRounds.TryCheck returns ErrOutOfScope instead of panicking
+// when the round is outside the current scope.
+func TestKnownRounds_TryCheck_OutOfScope(t *testing.T) {
+	kr := &KnownRounds{
+		bitStream:      uint64Buff{0, math.MaxUint64, 0, math.MaxUint64, 0},
+		firstUnchecked: 75,
+		lastChecked:    200,
+		fuPos:          11,
+	}
+	expected := kr.Marshal()
+
+	for _, rid := range []id.Round{520, 1000, math.MaxUint64} {
+		err := kr.TryCheck(rid)
+		if !errors.Is(err, ErrOutOfScope) {
+			t.Errorf("TryCheck did not return the expected error for round "+
+				"%d.\nexpected: %v\nreceived: %+v", rid, ErrOutOfScope, err)
+		}
+	}
+
+	if !bytes.Equal(expected, kr.Marshal()) {
+		t.Errorf("TryCheck modified the KnownRounds on error.")
+	}
+
+	if err := NewKnownRound(0).TryCheck(5); !errors.Is(err, ErrOutOfScope) {
+		t.Errorf("TryCheck did not return the expected error for an empty "+
+			"buffer.\nexpected: %v\nreceived: %+v", ErrOutOfScope, err)
+	}
+}
+
+// Tests that KnownRounds.TryCheck modifies the KnownRounds the same way as
+// KnownRounds.Check for rounds in scope.
+func TestKnownRounds_TryCheck(t *testing.T) {
+	for _, rid := range []id.Round{0, 75, 95, 150, 320, 519} {
+		kr1 := &KnownRounds{
+			bitStream:      uint64Buff{0, math.MaxUint64, 0, math.MaxUint64, 0},
+			firstUnchecked: 75,
+			lastChecked:    200,
+			fuPos:          11,
+		}
+		kr2 := &KnownRounds{
+			bitStream:      kr1.bitStream.deepCopy(),
+			firstUnchecked: 75,
+			lastChecked:    200,
+			fuPos:          11,
+		}
+
+		kr1.Check(rid)
+		if err := kr2.TryCheck(rid); err != nil {
+			t.Errorf("TryCheck returned an error for round %d: %+v", rid, err)
+		}
+
+		if !reflect.DeepEqual(kr1, kr2) {
+			t.Errorf("TryCheck did not match Check for round %d."+
+				"\nexpected: %+v\nreceived: %+v", rid, kr1, kr2)
+		}
+	}
+}
+
+// Tests that KnownRounds.Unmarshal loads data written by older versions of
+// Marshal, which dropped the final block of the bit stream when lastChecked was
+// on a block boundary.
+func TestKnownRounds_Unmarshal_LegacyShortBitStream(t *testing.T) {
+	// Output of Marshal from before the block count fix for:
+	//  kr := NewKnownRound(256); kr.Check(5); kr.Check(64)
+	data := []byte{0, 0, 0, 0, 0, 0, 0, 0, 64, 0, 0, 0, 0, 0, 0, 0, 2, 1, 4, 0,
+		7}
+
+	kr := NewKnownRound(256)
+	if err := kr.Unmarshal(data); err != nil {
+		t.Fatalf("Failed to unmarshal legacy data: %+v", err)
+	}
+
+	if kr.firstUnchecked != 0 || kr.lastChecked != 64 {
+		t.Errorf("Unexpected firstUnchecked and lastChecked."+
+			"\nexpected: %d, %d\nreceived: %d, %d",
+			0, 64, kr.firstUnchecked, kr.lastChecked)
+	}
+
+	// Round 64 was in the dropped block, so it is lost like it was when the
+	// data was loaded by older versions of Unmarshal
+	for rid, checked := range map[id.Round]bool{5: true, 4: false, 63: false,
+		64: false} {
+		if kr.Checked(rid) != checked {
+			t.Errorf("Unexpected state for round %d.\nexpected: %t"+
+				"\nreceived: %t", rid, checked, kr.Checked(rid))
+		}
+	}
+
+	// The same data into a KnownRounds without a buffer
+	kr = &KnownRounds{}
+	if err := kr.Unmarshal(data); err != nil {
+		t.Fatalf("Failed to unmarshal legacy data: %+v", err)
+	}
+	if !kr.Checked(5) || kr.Checked(6) {
+		t.Errorf("Unexpected rounds checked after unmarshal.")
+	}
+}
+
+// Tests that KnownRounds.Unmarshal does not keep the memory of a large decoded
+// bit stream after trimming it and that it rejects a bit stream larger than
+// the KnownRounds can hold before allocating it.
+func TestKnownRounds_Unmarshal_LargeBitStream(t *testing.T) {
+	// Version 3 bit stream of MaxUnmarshalBlocks blocks with a single run of
+	// 0 bits, with lastChecked before firstUnchecked
+	data := []byte{75, 0, 0, 0, 0, 0, 0, 0, 10, 0, 0, 0, 0, 0, 0, 0,
+		bitRunVersion, u64bLen, 0x80, 0x80, 0x80, 0x02, 0x80, 0x80, 0x80, 0x80,
+		0x01}
+
+	kr := &KnownRounds{}
+	if err := kr.Unmarshal(data); err != nil {
+		t.Fatalf("Failed to unmarshal: %+v", err)
+	}
+	if cap(kr.bitStream) != 1 {
+		t.Errorf("Unexpected bit stream capacity.\nexpected: %d\nreceived: %d",
+			1, cap(kr.bitStream))
+	}
+	if !kr.Checked(74) || kr.Checked(75) {
+		t.Errorf("Unexpected rounds checked after unmarshal: %+v", kr)
+	}
+
+	kr = NewKnownRound(64)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if err := kr.Unmarshal(data); err == nil {
+		t.Errorf("Unmarshal did not return an error for a bit stream larger " +
+			"than the KnownRounds.")
+	}
+	runtime.ReadMemStats(&after)
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("Unmarshal allocated %d bytes before rejecting the bit "+
+			"stream.", allocated)
+	}
+	if cap(kr.bitStream) != 1 {
+		t.Errorf("Unexpected bit stream capacity.\nexpected: %d\nreceived: %d",
+			1, cap(kr.bitStream))
+	}
+}
+
+// Tests that a KnownRounds returned by Truncate, where firstUnchecked is more
+// than one after lastChecked, round-trips through Marshal and Unmarshal. The
+// golden data is the output of Marshal from before Unmarshal validated its
+// input.
+func TestKnownRounds_Marshal_Unmarshal_Truncated(t *testing.T) {
+	kr := NewKnownRound(256)
+	kr.Check(5)
+	kr.Check(10)
+	truncated := kr.Truncate(50)
+
+	golden := []byte{50, 0, 0, 0, 0, 0, 0, 0, 10, 0, 0, 0, 0, 0, 0, 0, 2, 1, 4,
+		32, 0, 30, 4, 32, 0, 6}
+
+	for i, data := range [][]byte{truncated.Marshal(), golden} {
+		newKr := NewKnownRound(256)
+		if err := newKr.Unmarshal(data); err != nil {
+			t.Fatalf("Failed to unmarshal truncated KnownRounds (%d): %+v",
+				i, err)
+		}
+
+		if !truncated.Equal(newKr) {
+			t.Errorf("Unmarshalled KnownRounds does not match (%d)."+
+				"\nexpected: %s\nreceived: %s", i, truncated, newKr)
+		}
+
+		if !newKr.Checked(49) || newKr.Checked(50) {
+			t.Errorf("Unexpected rounds checked after unmarshal (%d).", i)
+		}
+	}
+}
+
+// Tests that KnownRounds.Unmarshal returns ErrCorruptEncoding for malformed
+// data and does not modify the KnownRounds.
+func TestKnownRounds_Unmarshal_CorruptEncoding(t *testing.T) {
+	header := []byte{75, 0, 0, 0, 0, 0, 0, 0, 150, 0, 0, 0, 0, 0, 0, 0}
+	testData := [][]byte{
+		{},
+		header[:15],
+		append(header, 2, 1),
+		append(header, 3, 1, 255, 8),
+		append(header, 2, 9, 255, 8),
+		append(header, 2, 1, 255, 8, 0),
+		append(header, 2, 2, 0, 0),
+		append(header, 2, 2, 0, 0, 0),
+		append(header, 2, 4, 0, 0, 0, 0, 0, 0),
+		append(header, 2, 8, 0, 0, 0, 0, 0, 0, 0, 0),
+		append(header, 2, 8, 0, 0, 0, 0, 0, 0, 0, 0, 255, 255, 255, 255, 255,
+			255, 255, 255),
+		append(header, 2, 4, 0, 0, 0, 0, 255, 255, 255, 255),
+		append(header, 2, 1, 0, 0),
+		append([]byte{75, 0, 0, 0, 0, 0, 0, 0, 250, 0, 0, 0, 0, 0, 0, 0},
+			2, 1, 255, 8),
+	}
+
+	for i, data := range testData {
+		kr := &KnownRounds{
+			bitStream:      uint64Buff{0, math.MaxUint64, 0, math.MaxUint64, 0},
+			firstUnchecked: 5,
+			lastChecked:    10,
+			fuPos:          5,
+		}
+		expected := kr.Marshal()
+
+		err := kr.Unmarshal(data)
+		if !errors.Is(err, ErrCorruptEncoding) {
+			t.Errorf("Unmarshal did not return the expected error (%d)."+
+				"\nexpected: %v\nreceived: %+v", i, ErrCorruptEncoding, err)
+		}
+
+		if !bytes.Equal(expected, kr.Marshal()) {
+			t.Errorf("Unmarshal modified the KnownRounds on error (%d).", i)
+		}
+	}
+}
+
+// Tests that no input to KnownRounds.Unmarshal causes a panic and that any
+// successfully unmarshalled KnownRounds can be used without panicking.
+func FuzzKnownRounds_Unmarshal(f *testing.F) {
+	f.Add([]byte{75, 0, 0, 0, 0, 0, 0, 0, 150, 0, 0, 0, 0, 0, 0, 0, 2, 1,
+		255, 8, 0, 8})
+	f.Add([]byte{174, 69, 206, 0, 0, 0, 0, 0, 150, 73, 206, 0, 0, 0, 0, 0, 2,
+		1, 0, 136})
+	f.Add([]byte("00000000@0000000\x02\x010\x00C0000"))
+	f.Add((&KnownRounds{
+		bitStream:      uint64Buff{0, math.MaxUint64, 0, math.MaxUint64, 0},
+		firstUnchecked: 55,
+		lastChecked:    270,
+		fuPos:          55,
+	}).Marshal())
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, kr := range []*KnownRounds{{}, NewKnownRound(310)} {
+			if err := kr.Unmarshal(data); err != nil {
+				continue
+			}
+
+			end := kr.lastChecked
+			if end-kr.firstUnchecked > 1000 {
+				end = kr.firstUnchecked + 1000
+			}
+			for rid := kr.firstUnchecked; rid <= end && rid >= kr.firstUnchecked; rid++ {
+				kr.Checked(rid)
+			}
+
+			if err := (&KnownRounds{}).Unmarshal(kr.Marshal()); err != nil {
+				t.Errorf("Failed to unmarshal remarshalled data: %+v", err)
+			}
+
+			_ = kr.TryCheck(kr.lastChecked + 1)
+		}
+	})
+}
+
+// Tests that a KnownRounds marshalled with each encoding using
+// KnownRounds.MarshalWithOptions can be unmarshalled with KnownRounds.Unmarshal.
+func TestKnownRounds_MarshalWithOptions(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 50; i++ {
+		kr := makeRandomKnownRounds(prng)
+		expected := kr.Marshal()
+
+		for e := EncodingAuto; e <= EncodingBitRun; e++ {
+			data, err := kr.MarshalWithOptions(MarshalOptions{Encoding: e})
+			if err != nil {
+				t.Fatalf("MarshalWithOptions returned an error for encoding "+
+					"%d (%d): %+v", e, i, err)
+			}
+
+			if e == Encoding1Byte && !bytes.Equal(expected, data) {
+				t.Errorf("Encoding1Byte does not match Marshal (%d)."+
+					"\nexpected: %v\nreceived: %v", i, expected, data)
+			}
+
+			// Only an explicitly selected EncodingBitRun uses version 3
+			if version := data[16]; (e == EncodingBitRun) !=
+				(version == bitRunVersion) {
+				t.Errorf("Encoding %d used encoding version %d (%d).",
+					e, version, i)
+			}
+
+			newKR := &KnownRounds{}
+			if err = newKR.Unmarshal(data); err != nil {
+				t.Fatalf("Failed to unmarshal encoding %d (%d): %+v", e, i, err)
+			}
+
+			if !bytes.Equal(expected, newKR.Marshal()) {
+				t.Errorf("Unmarshalled KnownRounds with encoding %d does not "+
+					"match original (%d).\nexpected: %v\nreceived: %v",
+					e, i, expected, newKR.Marshal())
+			}
+		}
+	}
+}
+
+// Error path: tests that KnownRounds.MarshalWithOptions returns an error for
+// an unrecognized encoding.
+func TestKnownRounds_MarshalWithOptions_InvalidEncodingError(t *testing.T) {
+	_, err := NewKnownRound(64).MarshalWithOptions(
+		MarshalOptions{Encoding: EncodingBitRun + 1})
+	if err == nil {
+		t.Errorf("MarshalWithOptions did not return an error for an invalid " +
+			"encoding.")
+	}
+}
+
+// Number of rounds checked per iteration of the check benchmarks.
+const benchmarkRounds = 10_000_000
+
+// Benchmarks checking 10M rounds in order.
+func BenchmarkKnownRounds_Check_Sequential(b *testing.B) {
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		kr := NewKnownRound(64 * 1024)
+		for rid := id.Round(0); rid < benchmarkRounds; rid++ {
+			kr.Check(rid)
+		}
+	}
+	b.ReportMetric(
+		float64(b.N)*benchmarkRounds/time.Since(start).Seconds(), "checks/s")
+}
+
+// Benchmarks checking 10M rounds in a random order within a sliding window, as
+// happens when rounds complete out of order.
+func BenchmarkKnownRounds_Check_Random(b *testing.B) {
+	rounds := makeShuffledRounds(benchmarkRounds, 4096)
+
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		kr := NewKnownRound(64 * 1024)
+		for _, rid := range rounds {
+			kr.Check(rid)
+		}
+	}
+	b.ReportMetric(
+		float64(b.N)*benchmarkRounds/time.Since(start).Seconds(), "checks/s")
+}
+
+// Benchmarks looking up 10M rounds in a window where every other round is
+// checked.
+func BenchmarkKnownRounds_Checked(b *testing.B) {
+	kr := NewKnownRound(64 * 1024)
+	for rid := id.Round(0); rid < 64*1024; rid += 2 {
+		kr.Check(rid)
+	}
+	rounds := makeShuffledRounds(benchmarkRounds, 64*1024)
+
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		for _, rid := range rounds {
+			kr.Checked(rid % (64 * 1024))
+		}
+	}
+	b.ReportMetric(
+		float64(b.N)*benchmarkRounds/time.Since(start).Seconds(), "lookups/s")
+}
+
+// Benchmarks forwarding through a fully checked window, which moves
+// firstUnchecked across whole words.
+func BenchmarkKnownRounds_Forward(b *testing.B) {
+	kr := NewKnownRound(64 * 1024)
+	for rid := id.Round(1); rid < 64*1024; rid++ {
+		kr.Check(rid)
+	}
+	bitStream := kr.bitStream.deepCopy()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		kr.firstUnchecked, kr.fuPos = 0, 0
+		copy(kr.bitStream, bitStream)
+		kr.Forward(1)
+	}
+}
+
+// makeShuffledRounds returns the rounds from 0 to n-1 shuffled within
+// consecutive windows of the given size.
+func makeShuffledRounds(n, window int) []id.Round {
+	prng := rand.New(rand.NewSource(42))
+	rounds := make([]id.Round, n)
+	for i := range rounds {
+		rounds[i] = id.Round(i)
+	}
+	for start := 0; start < n; start += window {
+		end := start + window
+		if end > n {
+			end = n
+		}
+		prng.Shuffle(end-start, func(i, j int) {
+			rounds[start+i], rounds[start+j] = rounds[start+j], rounds[start+i]
+		})
+	}
+	return rounds
+}
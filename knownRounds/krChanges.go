@@ -0,0 +1,137 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package knownRounds
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Current encoding version of marshalled KrChanges.
+const krChangesVersion = 0
+
+// Marshal encodes the changes into a byte slice. The changes are sorted by
+// word index so that the output is deterministic. Each index is stored as the
+// difference from the previous index to keep the encoding small.
+//
+// The data is encoded in the following structure:
+// +---------+----------+---------------+----------+-----+
+// | version |  count   | index delta 1 |  word 1  | ... |
+// | 1 byte  | uvarint  |    uvarint    | 8 bytes  |     |
+// +---------+----------+---------------+----------+-----+
+func (krc KrChanges) Marshal() []byte {
+	indexes := make([]int, 0, len(krc))
+	for i := range krc {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	buf := bytes.NewBuffer([]byte{krChangesVersion})
+	b := make([]byte, binary.MaxVarintLen64)
+	buf.Write(b[:binary.PutUvarint(b, uint64(len(krc)))])
+
+	prev := 0
+	for _, i := range indexes {
+		buf.Write(b[:binary.PutUvarint(b, uint64(i-prev))])
+		buf.Write(write8Bytes(krc[i]))
+		prev = i
+	}
+
+	return buf.Bytes()
+}
+
+// UnmarshalKrChanges decodes the byte slice produced by KrChanges.Marshal.
+// Malformed data returns an error wrapping ErrCorruptEncoding.
+func UnmarshalKrChanges(data []byte) (KrChanges, error) {
+	buf := bytes.NewReader(data)
+
+	version, err := buf.ReadByte()
+	if err != nil {
+		return nil, errors.Wrap(ErrCorruptEncoding, "KrChanges data is empty")
+	} else if version != krChangesVersion {
+		return nil, errors.Wrapf(ErrCorruptEncoding,
+			"KrChanges encoding version %d unrecognized", version)
+	}
+
+	count, err := binary.ReadUvarint(buf)
+	if err != nil {
+		return nil, errors.Wrapf(ErrCorruptEncoding,
+			"failed to read KrChanges count: %+v", err)
+	} else if count > uint64(buf.Len()/(1+u64bLen)) {
+		return nil, errors.Wrapf(ErrCorruptEncoding, "KrChanges count %d "+
+			"larger than remaining data of size %d", count, buf.Len())
+	}
+
+	krc := make(KrChanges, count)
+	index := uint64(0)
+	for n := uint64(0); n < count; n++ {
+		delta, err := binary.ReadUvarint(buf)
+		if err != nil {
+			return nil, errors.Wrapf(ErrCorruptEncoding,
+				"failed to read index of change %d: %+v", n, err)
+		} else if n > 0 && delta == 0 {
+			return nil, errors.Wrapf(ErrCorruptEncoding,
+				"duplicate index %d in change %d", index, n)
+		}
+
+		index += delta
+		if delta > MaxUnmarshalBlocks || index > MaxUnmarshalBlocks {
+			return nil, errors.Wrapf(ErrCorruptEncoding, "index %d of change "+
+				"%d larger than maximum %d", index, n, MaxUnmarshalBlocks)
+		}
+
+		word := make([]byte, u64bLen)
+		if _, err = io.ReadFull(buf, word); err != nil {
+			return nil, errors.Wrapf(ErrCorruptEncoding,
+				"failed to read word of change %d: %+v", n, err)
+		}
+		krc[int(index)] = binary.LittleEndian.Uint64(word)
+	}
+
+	if buf.Len() != 0 {
+		return nil, errors.Wrapf(ErrCorruptEncoding, "extraneous data of "+
+			"length %d found at end of KrChanges", buf.Len())
+	}
+
+	return krc, nil
+}
+
+// ApplyChanges applies the changes produced by OutputBuffChanges to the
+// KnownRounds and sets its firstUnchecked, lastChecked, and fuPos. An error is
+// returned if a change or fuPos is outside the bit stream, in which case the
+// KnownRounds is not modified.
+func (kr *KnownRounds) ApplyChanges(changes KrChanges, firstUnchecked,
+	lastChecked id.Round, fuPos int) error {
+	if fuPos < 0 || fuPos >= kr.Len() {
+		return errors.Errorf("fuPos %d outside of bit stream of size %d",
+			fuPos, kr.Len())
+	}
+
+	for i := range changes {
+		if i < 0 || i >= len(kr.bitStream) {
+			return errors.Errorf("change at index %d outside of bit stream "+
+				"of length %d", i, len(kr.bitStream))
+		}
+	}
+
+	for i, word := range changes {
+		kr.bitStream[i] = word
+	}
+
+	kr.firstUnchecked = firstUnchecked
+	kr.lastChecked = lastChecked
+	kr.fuPos = fuPos
+
+	return nil
+}
@@ -0,0 +1,149 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package knownRounds
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Tests that KrChanges marshalled via KrChanges.Marshal and unmarshalled via
+// UnmarshalKrChanges match the original.
+func TestKrChanges_Marshal_UnmarshalKrChanges(t *testing.T) {
+	const max = math.MaxUint64
+	testData := []KrChanges{
+		{},
+		{0: 0},
+		{0: 1, 1: max, 2: 0, 3: max, 4: 0},
+		{5: 42, 1000: max, 64: 0x13374AFB434FF},
+	}
+
+	for i, krc := range testData {
+		data := krc.Marshal()
+		received, err := UnmarshalKrChanges(data)
+		if err != nil {
+			t.Errorf("UnmarshalKrChanges returned an error (%d): %+v", i, err)
+		}
+
+		if !reflect.DeepEqual(krc, received) {
+			t.Errorf("Unmarshalled KrChanges does not match original (%d)."+
+				"\nexpected: %v\nreceived: %v", i, krc, received)
+		}
+	}
+}
+
+// Tests that KrChanges.Marshal produces the expected bytes regardless of map
+// iteration order.
+func TestKrChanges_Marshal(t *testing.T) {
+	krc := KrChanges{3: 1, 1: 0xFF}
+	expected := []byte{krChangesVersion, 2,
+		1, 0xFF, 0, 0, 0, 0, 0, 0, 0,
+		2, 1, 0, 0, 0, 0, 0, 0, 0}
+
+	for i := 0; i < 10; i++ {
+		if data := krc.Marshal(); !bytes.Equal(expected, data) {
+			t.Fatalf("Marshal produced unexpected data."+
+				"\nexpected: %v\nreceived: %v", expected, data)
+		}
+	}
+}
+
+// Error path: tests that UnmarshalKrChanges returns ErrCorruptEncoding for
+// malformed data.
+func TestUnmarshalKrChanges_CorruptEncoding(t *testing.T) {
+	testData := [][]byte{
+		{},
+		{1},
+		{krChangesVersion},
+		{krChangesVersion, 1},
+		{krChangesVersion, 1, 0, 1, 2, 3},
+		{krChangesVersion, 2, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0,
+			0, 0},
+		{krChangesVersion, 1, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+			0xFF, 0x01, 1, 0, 0, 0, 0, 0, 0, 0},
+		{krChangesVersion, 1, 0, 1, 0, 0, 0, 0, 0, 0, 0, 5},
+		{krChangesVersion, 0xFF, 0xFF, 0xFF, 0xFF, 0x0F},
+	}
+
+	for i, data := range testData {
+		_, err := UnmarshalKrChanges(data)
+		if !errors.Is(err, ErrCorruptEncoding) {
+			t.Errorf("UnmarshalKrChanges did not return the expected error "+
+				"(%d).\nexpected: %v\nreceived: %+v", i, ErrCorruptEncoding, err)
+		}
+	}
+}
+
+// Simulates a write-ahead log by marshalling the changes after each random
+// edit and replaying them with KnownRounds.ApplyChanges onto a copy.
+func TestKnownRounds_ApplyChanges(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+	kr := NewKnownRound(64 * 32)
+	saved := NewKnownRound(64 * 32)
+	old := kr.GetBitStream()
+
+	for i := 0; i < 500; i++ {
+		kr.ForceCheck(id.Round(prng.Int63n(int64(i*8 + 1))))
+
+		changes, fu, lc, fuPos, err := kr.OutputBuffChanges(old)
+		if err != nil {
+			t.Fatalf("Failed to output changes (%d): %+v", i, err)
+		}
+		old = kr.GetBitStream()
+
+		changes, err = UnmarshalKrChanges(changes.Marshal())
+		if err != nil {
+			t.Fatalf("Failed to unmarshal changes (%d): %+v", i, err)
+		}
+
+		if err = saved.ApplyChanges(changes, fu, lc, fuPos); err != nil {
+			t.Fatalf("Failed to apply changes (%d): %+v", i, err)
+		}
+
+		if !reflect.DeepEqual(kr, saved) {
+			t.Fatalf("Replayed KnownRounds does not match original (%d)."+
+				"\nexpected: %+v\nreceived: %+v", i, kr, saved)
+		}
+	}
+}
+
+// Error path: tests that KnownRounds.ApplyChanges returns an error and does
+// not modify the KnownRounds when a change or fuPos is out of range.
+func TestKnownRounds_ApplyChanges_OutOfRangeError(t *testing.T) {
+	testData := []struct {
+		changes KrChanges
+		fuPos   int
+		err     string
+	}{
+		{KrChanges{0: 1, 5: 1}, 0, "outside of bit stream of length"},
+		{KrChanges{0: 1, -1: 1}, 0, "outside of bit stream of length"},
+		{KrChanges{0: 1}, 320, "outside of bit stream of size"},
+		{KrChanges{0: 1}, -1, "outside of bit stream of size"},
+	}
+
+	for i, data := range testData {
+		kr := NewKnownRound(310)
+		err := kr.ApplyChanges(data.changes, 5, 10, data.fuPos)
+		if err == nil || !strings.Contains(err.Error(), data.err) {
+			t.Errorf("ApplyChanges did not return the expected error (%d)."+
+				"\nexpected: %s\nreceived: %+v", i, data.err, err)
+		}
+
+		if !reflect.DeepEqual(NewKnownRound(310), kr) {
+			t.Errorf("ApplyChanges modified the KnownRounds on error (%d)."+
+				"\nexpected: %+v\nreceived: %+v", i, NewKnownRound(310), kr)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package knownRounds
+
+import (
+	"math/bits"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// CheckMaskedRange is a variant of RangeUncheckedMaskedRange that does not
+// modify the mask and returns the rounds it checked, in the order they were
+// checked.
+//
+// First, the rounds checked in the mask at or after kr's firstUnchecked are
+// visited from newest to oldest. Then, the rounds from start up to (but not
+// including) end that are before the mask's first unchecked round are visited
+// from oldest to newest. For each visited round that is unchecked in kr,
+// roundCheck is called and, if it returns true, the round is checked in kr.
+// At most maxChecked rounds are visited in total.
+//
+// Unlike RangeUncheckedMaskedRange, the mask's last checked round is included
+// and the two buffers are compared a word at a time without making a copy of
+// either. If a round cannot be checked because it is outside the scope of kr,
+// then the rounds checked so far are returned with an error wrapping
+// ErrOutOfScope.
+func (kr *KnownRounds) CheckMaskedRange(mask *KnownRounds,
+	roundCheck RoundCheckFunc, start, end id.Round, maxChecked int) (
+	[]id.Round, error) {
+
+	var checked []id.Round
+	var err error
+	numChecked := 0
+
+	// Check a single round, stopping on error. The round is checked in kr
+	// again because checking a newer round may have moved firstUnchecked past
+	// it.
+	check := func(rid id.Round) bool {
+		if !kr.Checked(rid) && roundCheck(rid) {
+			if err = kr.TryCheck(rid); err != nil {
+				return false
+			}
+			checked = append(checked, rid)
+		}
+		return true
+	}
+
+	// Calculate the first unchecked round the mask would have if forwarded to
+	// kr's firstUnchecked
+	maskFu, maskLc := mask.firstUnchecked, mask.lastChecked
+	if maskFu != maskLc {
+		if kr.firstUnchecked > maskLc {
+			// Every round in the mask window is already checked in kr
+			maskFu, maskLc = kr.firstUnchecked, kr.firstUnchecked-1
+		} else if kr.firstUnchecked > maskFu {
+			maskFu = mask.nextUnchecked(kr.firstUnchecked)
+		}
+
+		// Visit the newest rounds in the mask window first
+		if maskFu <= maskLc && maxChecked > 0 {
+			low := maskFu
+			if uint64(maskLc-maskFu) >= uint64(maxChecked) {
+				low = maskLc - id.Round(maxChecked-1)
+			}
+			numChecked = int(maskLc-low) + 1
+
+			forEachSetRound(low, maskLc, true, func(ws id.Round) uint64 {
+				return mask.getWord(ws) &^ kr.getWord(ws)
+			}, check)
+
+			if err != nil {
+				return checked, err
+			}
+		}
+	}
+
+	if start < kr.firstUnchecked {
+		start = kr.firstUnchecked
+	}
+
+	if end > maskFu {
+		end = maskFu
+	}
+
+	// Visit the rounds before the mask window
+	if start < end && numChecked < maxChecked {
+		high := end - 1
+		if uint64(high-start) >= uint64(maxChecked-numChecked) {
+			high = start + id.Round(maxChecked-numChecked-1)
+		}
+
+		forEachSetRound(start, high, false, func(ws id.Round) uint64 {
+			return ^kr.getWord(ws)
+		}, check)
+	}
+
+	return checked, err
+}
+
+// nextUnchecked returns the first unchecked round at or after rid, which must
+// not be before firstUnchecked. If every round up to lastChecked is checked,
+// then the round after lastChecked is returned.
+func (kr *KnownRounds) nextUnchecked(rid id.Round) id.Round {
+	for {
+		word := kr.getWord(rid)
+		if word != ones {
+			return rid + id.Round(bits.LeadingZeros64(^word))
+		}
+		rid += 64
+	}
+}
+
+// forEachSetRound calls fn for each round from low to high (inclusive) whose
+// bit is set in the word returned by wordAt, in descending order if reverse is
+// true. wordAt is called once for each 64-round aligned word in the range,
+// right before its rounds are visited, with the first round of the word.
+// Iteration stops if fn returns false.
+func forEachSetRound(low, high id.Round, reverse bool,
+	wordAt func(ws id.Round) uint64, fn func(rid id.Round) bool) {
+
+	first, last := low&^63, high&^63
+	ws := first
+	if reverse {
+		ws = last
+	}
+
+	for {
+		word := wordAt(ws)
+
+		// Clear the bits outside the range
+		if ws == first {
+			word &= ones >> uint(low-ws)
+		}
+		if ws == last {
+			word &= ^(ones >> uint(high-ws+1))
+		}
+
+		for word != 0 {
+			var bit int
+			if reverse {
+				bit = 63 - bits.TrailingZeros64(word)
+			} else {
+				bit = bits.LeadingZeros64(word)
+			}
+			word &^= 1 << uint(63-bit)
+
+			if !fn(ws + id.Round(bit)) {
+				return
+			}
+		}
+
+		if reverse {
+			if ws == first {
+				return
+			}
+			ws -= 64
+		} else {
+			if ws == last {
+				return
+			}
+			ws += 64
+		}
+	}
+}
@@ -0,0 +1,173 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package knownRounds
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Tests that KnownRounds.CheckMaskedRange checks the same rounds as a
+// round-by-round implementation for random KnownRounds and masks, and that the
+// mask is not modified.
+func TestKnownRounds_CheckMaskedRange(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 500; i++ {
+		kr := makeRandomKnownRounds(prng)
+		mask := makeRandomKnownRounds(prng)
+		krCopy := kr.Clone()
+		maskCopy := mask.Clone()
+
+		start := id.Round(prng.Intn(400))
+		end := start + id.Round(prng.Intn(400))
+		maxChecked := prng.Intn(500)
+		seed := prng.Int63()
+		roundCheck := func(rid id.Round) bool {
+			return rand.New(rand.NewSource(seed+int64(rid))).Intn(2) == 0
+		}
+
+		expected, expectedErr := checkMaskedRangeReference(
+			krCopy, mask, roundCheck, start, end, maxChecked)
+
+		checked, err := kr.CheckMaskedRange(
+			mask, roundCheck, start, end, maxChecked)
+		if (expectedErr == nil) != (err == nil) {
+			t.Errorf("Unexpected error (%d).\nexpected: %v\nreceived: %+v",
+				i, expectedErr, err)
+		} else if err != nil && !errors.Is(err, ErrOutOfScope) {
+			t.Errorf("Error does not wrap ErrOutOfScope (%d): %+v", i, err)
+		}
+
+		if !reflect.DeepEqual(expected, checked) {
+			t.Errorf("Unexpected checked rounds (%d).\nexpected: %v"+
+				"\nreceived: %v", i, expected, checked)
+		}
+
+		if !reflect.DeepEqual(krCopy, kr) {
+			t.Errorf("KnownRounds does not match reference (%d)."+
+				"\nexpected: %+v\nreceived: %+v", i, krCopy, kr)
+		}
+
+		if !reflect.DeepEqual(maskCopy, mask) {
+			t.Errorf("Mask was modified (%d).\nexpected: %+v\nreceived: %+v",
+				i, maskCopy, mask)
+		}
+	}
+}
+
+// Tests that KnownRounds.CheckMaskedRange checks the rounds set in the mask
+// newest first and then the requested rounds before the mask.
+func TestKnownRounds_CheckMaskedRange_Order(t *testing.T) {
+	kr := NewKnownRound(256)
+	kr.Forward(10)
+	kr.Check(100)
+
+	mask := NewKnownRound(256)
+	mask.Forward(50)
+	for _, rid := range []id.Round{51, 70, 71, 150} {
+		mask.Check(rid)
+	}
+
+	checked, err := kr.CheckMaskedRange(mask, func(id.Round) bool {
+		return true
+	}, 0, math.MaxUint64, 141)
+	if err != nil {
+		t.Fatalf("CheckMaskedRange returned an error: %+v", err)
+	}
+
+	expected := []id.Round{150, 71, 70, 51}
+	expected = append(expected, makeRange(10, 49)...)
+	if !reflect.DeepEqual(expected, checked) {
+		t.Errorf("Unexpected checked rounds.\nexpected: %v\nreceived: %v",
+			expected, checked)
+	}
+
+	checked, err = kr.CheckMaskedRange(mask, func(id.Round) bool {
+		return true
+	}, 0, math.MaxUint64, 0)
+	if err != nil || len(checked) != 0 {
+		t.Errorf("Rounds checked with maxChecked of 0: %v, %+v", checked, err)
+	}
+}
+
+// Error path: Tests that KnownRounds.CheckMaskedRange returns an error wrapping
+// ErrOutOfScope when a round in the mask is too far ahead of kr and returns
+// the rounds checked before it.
+func TestKnownRounds_CheckMaskedRange_OutOfScopeError(t *testing.T) {
+	kr := NewKnownRound(64)
+	kr.Check(5)
+
+	mask := NewKnownRound(256)
+	mask.Check(10)
+	mask.Check(200)
+
+	checked, err := kr.CheckMaskedRange(mask, func(rid id.Round) bool {
+		return true
+	}, 0, 0, 1000)
+	if !errors.Is(err, ErrOutOfScope) {
+		t.Errorf("Unexpected error.\nexpected: %v\nreceived: %+v",
+			ErrOutOfScope, err)
+	}
+
+	if len(checked) != 0 {
+		t.Errorf("Unexpected checked rounds: %v", checked)
+	}
+}
+
+// checkMaskedRangeReference implements KnownRounds.CheckMaskedRange one round
+// at a time on a copy of the mask.
+func checkMaskedRangeReference(kr, mask *KnownRounds, roundCheck RoundCheckFunc,
+	start, end id.Round, maxChecked int) ([]id.Round, error) {
+	mask = mask.Clone()
+	var checked []id.Round
+	numChecked := 0
+
+	if mask.firstUnchecked != mask.lastChecked {
+		mask.Forward(kr.firstUnchecked)
+		if mask.firstUnchecked > kr.firstUnchecked ||
+			mask.lastChecked != kr.firstUnchecked {
+			for i := mask.lastChecked; i >= mask.firstUnchecked &&
+				numChecked < maxChecked; i, numChecked = i-1, numChecked+1 {
+				if mask.Checked(i) && !kr.Checked(i) && roundCheck(i) {
+					if err := kr.TryCheck(i); err != nil {
+						return checked, err
+					}
+					checked = append(checked, i)
+				}
+				if i == 0 {
+					break
+				}
+			}
+		}
+	}
+
+	if start < kr.firstUnchecked {
+		start = kr.firstUnchecked
+	}
+
+	if end > mask.firstUnchecked {
+		end = mask.firstUnchecked
+	}
+
+	for i := start; i < end && numChecked < maxChecked; i, numChecked = i+1, numChecked+1 {
+		if !kr.Checked(i) && roundCheck(i) {
+			if err := kr.TryCheck(i); err != nil {
+				return checked, err
+			}
+			checked = append(checked, i)
+		}
+	}
+
+	return checked, nil
+}
@@ -0,0 +1,227 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package knownRounds
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// rangeBatchPerWorker is the number of rounds checked per worker before the
+// results are collected. Rounds in a batch may be checked even if an earlier
+// round in the batch reaches maxPickups.
+const rangeBatchPerWorker = 4
+
+// maxRangeBatchLen is the maximum number of rounds, checked or not, held in a
+// batch.
+const maxRangeBatchLen = 4096
+
+// Delay before the first retry of a failed round check. The delay doubles on
+// each following retry up to retryMaxDelay. Each delay is randomly shortened by
+// up to half so that workers retrying at the same time spread out.
+const (
+	retryBaseDelay = 10 * time.Millisecond
+	retryMaxDelay  = time.Second
+)
+
+// RoundCheckContextFunc checks a round like RoundCheckFunc. It returns an error
+// if the check could not be completed, in which case the check may be retried.
+type RoundCheckContextFunc func(ctx context.Context, rid id.Round) (bool, error)
+
+// rangeItem is a single round processed by RangeUncheckedContext.
+type rangeItem struct {
+	rid     id.Round
+	checked bool  // Round is checked in the KnownRounds and needs roundCheck
+	has     bool  // Result of roundCheck
+	err     error // Set if roundCheck did not complete
+}
+
+// RangeUncheckedContext behaves like RangeUnchecked, except that roundCheck is
+// called concurrently by the given number of workers and each call that
+// returns an error is retried up to maxRetries times, with an exponential
+// backoff between attempts starting at 10 ms. The returned rounds are
+// the same as if the rounds were checked in order; roundCheck may be called on
+// a few rounds past the point where maxPickups is reached, but their results
+// are discarded.
+//
+// A round that fails every retry is treated as not yet checked: it is not
+// returned in has and earliestRound is not after it, so it is checked again on
+// the next call.
+//
+// If ctx is cancelled, then the rounds processed in order before the first
+// uncompleted check are returned along with the context's error.
+// earliestRound is not after the first uncompleted check so that a following
+// call resumes from it.
+//
+// kr must not be modified until RangeUncheckedContext returns.
+func (kr *KnownRounds) RangeUncheckedContext(ctx context.Context,
+	oldestUnknown id.Round, threshold uint, roundCheck RoundCheckContextFunc,
+	maxPickups, maxRetries, workers int) (
+	earliestRound id.Round, has, unknown []id.Round, err error) {
+
+	newestRound := kr.lastChecked
+
+	// Calculate how far back we should go back to check rounds
+	oldestPossibleEarliestRound := id.Round(1)
+	if newestRound > id.Round(threshold) {
+		oldestPossibleEarliestRound = newestRound - id.Round(threshold)
+	}
+
+	earliestRound = kr.lastChecked + 1
+	has = make([]id.Round, 0, maxPickups)
+
+	// If the oldest unknown round is outside the range we are attempting to
+	// check, then skip checking
+	if oldestUnknown > kr.lastChecked {
+		jww.TRACE.Printf(
+			"RangeUncheckedContext: oldestUnknown (%d) > kr.lastChecked (%d)",
+			oldestUnknown, kr.lastChecked)
+		return oldestUnknown, nil, nil, nil
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	// Start the worker pool
+	jobs := make(chan *rangeItem)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		go func() {
+			for item := range jobs {
+				item.has, item.err =
+					checkRound(ctx, roundCheck, item.rid, maxRetries)
+				wg.Done()
+			}
+		}()
+	}
+	defer close(jobs)
+
+	batchSize := workers * rangeBatchPerWorker
+	batch := make([]rangeItem, 0, batchSize)
+	numChecked := 0
+
+	for i := oldestUnknown; ; i++ {
+		// Add rounds to the batch until it has enough rounds to check or there
+		// are no more rounds
+		last := i == kr.lastChecked
+		item := rangeItem{rid: i, checked: kr.Checked(i)}
+		batch = append(batch, item)
+		if item.checked {
+			numChecked++
+		}
+		if numChecked < batchSize && len(batch) < maxRangeBatchLen && !last {
+			continue
+		}
+
+		// Check every round in the batch concurrently
+		for j := range batch {
+			if batch[j].checked {
+				wg.Add(1)
+				jobs <- &batch[j]
+			}
+		}
+		wg.Wait()
+
+		// Collect the results in order
+		for _, item := range batch {
+			// If the source does not know about the round, set that round as
+			// unknown and don't check it
+			if !item.checked {
+				if item.rid < oldestPossibleEarliestRound {
+					unknown = append(unknown, item.rid)
+				} else if item.rid < earliestRound {
+					earliestRound = item.rid
+				}
+				continue
+			}
+
+			if item.err != nil {
+				if item.rid < earliestRound {
+					earliestRound = item.rid
+				}
+
+				if ctx.Err() != nil {
+					return earliestRound, has, unknown, ctx.Err()
+				}
+
+				jww.WARN.Printf("RangeUncheckedContext: failed to check "+
+					"round %d after %d retries: %+v",
+					item.rid, maxRetries, item.err)
+				continue
+			}
+
+			if item.has {
+				has = append(has, item.rid)
+				// Do not pick up too many messages at once
+				if len(has) >= maxPickups {
+					nextRound := item.rid + 1
+					if nextRound < earliestRound {
+						earliestRound = nextRound
+					}
+					return earliestRound, has, unknown, nil
+				}
+			}
+		}
+
+		if last {
+			break
+		}
+		batch, numChecked = batch[:0], 0
+	}
+
+	return earliestRound, has, unknown, nil
+}
+
+// checkRound calls roundCheck until it succeeds, it fails maxRetries + 1
+// times, or the context is cancelled. It waits for retryDelay between
+// attempts.
+func checkRound(ctx context.Context, roundCheck RoundCheckContextFunc,
+	rid id.Round, maxRetries int) (bool, error) {
+	var err error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(retryDelay(attempt - 1))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return false, ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return false, ctxErr
+		}
+
+		var has bool
+		if has, err = roundCheck(ctx, rid); err == nil {
+			return has, nil
+		}
+	}
+
+	return false, err
+}
+
+// retryDelay returns the delay before the given retry, where 0 is the first
+// retry. The delay is retryBaseDelay doubled for each retry, capped at
+// retryMaxDelay, and then randomly reduced by up to half.
+func retryDelay(retry int) time.Duration {
+	d := retryMaxDelay
+	if retry < 32 && retryBaseDelay<<retry < retryMaxDelay {
+		d = retryBaseDelay << retry
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
@@ -0,0 +1,247 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package knownRounds
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Tests that KnownRounds.RangeUncheckedContext returns the same results as
+// KnownRounds.RangeUnchecked for random KnownRounds, pickup limits, and worker
+// counts.
+func TestKnownRounds_RangeUncheckedContext(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 300; i++ {
+		kr := makeRandomKnownRounds(prng)
+		oldestUnknown := id.Round(prng.Intn(int(kr.lastChecked) + 10))
+		threshold := uint(prng.Intn(kr.Len()))
+		maxPickups := prng.Intn(100)
+		workers := 1 + prng.Intn(8)
+		seed := prng.Int63()
+		roundCheck := func(rid id.Round) bool {
+			return rand.New(rand.NewSource(seed+int64(rid))).Intn(3) == 0
+		}
+
+		expectedEarliest, expectedHas, expectedUnknown :=
+			kr.RangeUnchecked(oldestUnknown, threshold, roundCheck, maxPickups)
+
+		earliest, has, unknown, err := kr.RangeUncheckedContext(
+			context.Background(), oldestUnknown, threshold,
+			func(_ context.Context, rid id.Round) (bool, error) {
+				return roundCheck(rid), nil
+			}, maxPickups, 0, workers)
+		if err != nil {
+			t.Fatalf("RangeUncheckedContext returned an error (%d): %+v", i, err)
+		}
+
+		if earliest != expectedEarliest {
+			t.Errorf("Unexpected earliest round (%d).\nexpected: %d"+
+				"\nreceived: %d", i, expectedEarliest, earliest)
+		}
+		if !reflect.DeepEqual(expectedHas, has) {
+			t.Errorf("Unexpected has list (%d).\nexpected: %v\nreceived: %v",
+				i, expectedHas, has)
+		}
+		if !reflect.DeepEqual(expectedUnknown, unknown) {
+			t.Errorf("Unexpected unknown list (%d).\nexpected: %v"+
+				"\nreceived: %v", i, expectedUnknown, unknown)
+		}
+	}
+}
+
+// Tests that KnownRounds.RangeUncheckedContext calls roundCheck from more than
+// one goroutine at a time.
+func TestKnownRounds_RangeUncheckedContext_Concurrent(t *testing.T) {
+	kr := NewKnownRound(640)
+	for rid := id.Round(0); rid < 600; rid++ {
+		kr.Check(rid)
+	}
+
+	var running, maxRunning int32
+	roundCheck := func(_ context.Context, rid id.Round) (bool, error) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return true, nil
+	}
+
+	_, has, _, err := kr.RangeUncheckedContext(
+		context.Background(), 0, 1000, roundCheck, 1000, 0, 8)
+	if err != nil {
+		t.Fatalf("RangeUncheckedContext returned an error: %+v", err)
+	}
+
+	if !reflect.DeepEqual(makeRange(0, 599), has) {
+		t.Errorf("Unexpected has list.\nexpected: %v\nreceived: %v",
+			makeRange(0, 599), has)
+	}
+
+	if maxRunning < 2 {
+		t.Errorf("roundCheck was not called concurrently.")
+	}
+}
+
+// Tests that KnownRounds.RangeUncheckedContext retries failed checks and that
+// a round that fails every retry is returned as the earliest round.
+func TestKnownRounds_RangeUncheckedContext_Retries(t *testing.T) {
+	kr := NewKnownRound(128)
+	for rid := id.Round(0); rid < 100; rid++ {
+		kr.Check(rid)
+	}
+
+	// Every round fails twice before succeeding, except round 40 which always
+	// fails
+	var mux sync.Mutex
+	attempts := make(map[id.Round]int)
+	roundCheck := func(_ context.Context, rid id.Round) (bool, error) {
+		mux.Lock()
+		defer mux.Unlock()
+		attempts[rid]++
+		if attempts[rid] <= 2 || rid == 40 {
+			return false, errors.New("lookup failed")
+		}
+		return true, nil
+	}
+
+	earliest, has, unknown, err := kr.RangeUncheckedContext(
+		context.Background(), 0, 1000, roundCheck, 1000, 2, 4)
+	if err != nil {
+		t.Fatalf("RangeUncheckedContext returned an error: %+v", err)
+	}
+
+	expectedHas := append(makeRange(0, 39), makeRange(41, 99)...)
+	if !reflect.DeepEqual(expectedHas, has) {
+		t.Errorf("Unexpected has list.\nexpected: %v\nreceived: %v",
+			expectedHas, has)
+	}
+	if earliest != 40 {
+		t.Errorf("Unexpected earliest round.\nexpected: %d\nreceived: %d",
+			40, earliest)
+	}
+	if unknown != nil {
+		t.Errorf("Unexpected unknown list: %v", unknown)
+	}
+	if attempts[40] != 3 {
+		t.Errorf("Round 40 checked %d times, expected %d.", attempts[40], 3)
+	}
+}
+
+// Tests that KnownRounds.RangeUncheckedContext waits between retries of a
+// failed check and stops waiting when the context is cancelled.
+func TestKnownRounds_RangeUncheckedContext_RetryBackoff(t *testing.T) {
+	kr := NewKnownRound(64)
+	kr.Check(0)
+
+	var mux sync.Mutex
+	var calls []time.Time
+	roundCheck := func(_ context.Context, rid id.Round) (bool, error) {
+		mux.Lock()
+		defer mux.Unlock()
+		calls = append(calls, time.Now())
+		return false, errors.New("lookup failed")
+	}
+
+	ctx, cancel :=
+		context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, _, _, err := kr.RangeUncheckedContext(ctx, 0, 1000, roundCheck, 1000,
+		1000, 1)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Unexpected error.\nexpected: %v\nreceived: %+v",
+			context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("RangeUncheckedContext took %s to stop after cancellation.",
+			elapsed)
+	}
+
+	mux.Lock()
+	defer mux.Unlock()
+	if len(calls) < 2 || len(calls) > 10 {
+		t.Fatalf("Unexpected number of attempts: %d", len(calls))
+	}
+	for i := 1; i < len(calls); i++ {
+		if gap := calls[i].Sub(calls[i-1]); gap < retryBaseDelay/2 {
+			t.Errorf("Retry %d made %s after the previous attempt.", i, gap)
+		}
+	}
+}
+
+// Tests that retryDelay doubles with each retry, is jittered by up to half,
+// and never exceeds retryMaxDelay.
+func TestRetryDelay(t *testing.T) {
+	for retry := 0; retry < 100; retry++ {
+		d := retryMaxDelay
+		if retry < 32 && retryBaseDelay<<retry < retryMaxDelay {
+			d = retryBaseDelay << retry
+		}
+
+		for i := 0; i < 10; i++ {
+			if delay := retryDelay(retry); delay < d/2 || delay > d {
+				t.Errorf("Delay for retry %d out of range [%s, %s]: %s",
+					retry, d/2, d, delay)
+			}
+		}
+	}
+}
+
+// Tests that KnownRounds.RangeUncheckedContext stops when the context is
+// cancelled and returns the results before the first uncompleted check.
+func TestKnownRounds_RangeUncheckedContext_Cancel(t *testing.T) {
+	kr := NewKnownRound(640)
+	for rid := id.Round(0); rid < 600; rid++ {
+		kr.Check(rid)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	roundCheck := func(ctx context.Context, rid id.Round) (bool, error) {
+		if rid == 100 {
+			cancel()
+		}
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	earliest, has, _, err :=
+		kr.RangeUncheckedContext(ctx, 0, 1000, roundCheck, 1000, 3, 4)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Unexpected error.\nexpected: %v\nreceived: %+v",
+			context.Canceled, err)
+	}
+
+	if len(has) > 100 || !reflect.DeepEqual(makeRange(0, len(has)-1), has) {
+		t.Errorf("has is not an in-order prefix before the cancelled round: %v",
+			has)
+	}
+
+	if earliest != id.Round(len(has)) {
+		t.Errorf("Unexpected earliest round.\nexpected: %d\nreceived: %d",
+			len(has), earliest)
+	}
+}
@@ -0,0 +1,177 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package knownRounds
+
+import (
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Union returns a new KnownRounds where a round is checked if it is checked in
+// either kr or other. Neither kr nor other are modified.
+func (kr *KnownRounds) Union(other *KnownRounds) *KnownRounds {
+	start, end := kr.firstUnchecked, kr.checkedEnd()
+	if other.firstUnchecked > start {
+		start = other.firstUnchecked
+	}
+	if otherEnd := other.checkedEnd(); otherEnd > end {
+		end = otherEnd
+	}
+
+	return combine(kr, other, start, end, func(a, b uint64) uint64 {
+		return a | b
+	})
+}
+
+// Intersect returns a new KnownRounds where a round is checked if it is checked
+// in both kr and other. Neither kr nor other are modified.
+func (kr *KnownRounds) Intersect(other *KnownRounds) *KnownRounds {
+	start, end := kr.firstUnchecked, kr.checkedEnd()
+	if other.firstUnchecked < start {
+		start = other.firstUnchecked
+	}
+	if otherEnd := other.checkedEnd(); otherEnd < end {
+		end = otherEnd
+	}
+
+	return combine(kr, other, start, end, func(a, b uint64) uint64 {
+		return a & b
+	})
+}
+
+// Difference returns a new KnownRounds where a round is checked if it is
+// checked in kr but not in other. Neither kr nor other are modified.
+//
+// Every round before other's firstUnchecked is checked in other and so is not
+// part of the difference. However, a KnownRounds considers every round before
+// its firstUnchecked to be checked, so those rounds are reported as checked in
+// the result. Only rounds from other.GetFirstUnchecked() onwards are
+// meaningful.
+func (kr *KnownRounds) Difference(other *KnownRounds) *KnownRounds {
+	return combine(kr, other, other.firstUnchecked, kr.checkedEnd(),
+		func(a, b uint64) uint64 { return a &^ b })
+}
+
+// combine returns a new KnownRounds with every round before start checked,
+// every round after end unchecked, and every round between them determined by
+// applying op to the words of a and b. The returned KnownRounds has the minimum
+// capacity needed to hold the rounds from start to end.
+func combine(a, b *KnownRounds, start, end id.Round,
+	op func(a, b uint64) uint64) *KnownRounds {
+	return buildKnownRounds(start, end, func(rid id.Round) uint64 {
+		return op(a.getWord(rid), b.getWord(rid))
+	})
+}
+
+// buildKnownRounds returns a new KnownRounds with every round before start
+// checked, every round after end unchecked, and every round between them set
+// from the words returned by wordAt. wordAt is called with the first round of
+// each block and returns the state of that round and the following 63 rounds
+// in the same format as getWord. The returned KnownRounds has the minimum
+// capacity needed to hold the rounds from start to end.
+func buildKnownRounds(
+	start, end id.Round, wordAt func(rid id.Round) uint64) *KnownRounds {
+
+	// Skip the leading blocks where every round is checked, since those rounds
+	// are before the firstUnchecked of the result and do not need to be stored
+	for start <= end {
+		offset := start % 64
+		if wordAt(start-offset)|^(ones>>uint(offset)) != ones {
+			break
+		}
+		start += 64 - offset
+		if start > end+1 {
+			start = end + 1
+		}
+	}
+
+	// If there are no rounds in the range, then all rounds before start are
+	// checked and all rounds after it are unchecked
+	if end < start {
+		return &KnownRounds{
+			bitStream:      make(uint64Buff, 1),
+			firstUnchecked: start,
+			lastChecked:    start,
+			fuPos:          int(start % 64),
+		}
+	}
+
+	offset := int(start % 64)
+	numBlocks := (offset + int(end-start) + 64) / 64
+	result := &KnownRounds{
+		bitStream:      make(uint64Buff, numBlocks),
+		firstUnchecked: start,
+		lastChecked:    end,
+		fuPos:          offset,
+	}
+
+	// Get each word, where the first word is aligned to the start of the block
+	// containing start
+	blockStart := start - id.Round(offset)
+	for i := range result.bitStream {
+		result.bitStream[i] = wordAt(blockStart + id.Round(i*64))
+	}
+
+	// Clear the bits outside the range so the bit stream is deterministic
+	result.bitStream[0] &= ones >> uint(offset)
+	_, endOffset := result.bitStream.convertEnd(offset + int(end-start) + 1)
+	result.bitStream[numBlocks-1] &= ^(ones >> uint(endOffset))
+
+	result.migrateFirstUnchecked(start)
+
+	return result
+}
+
+// getWord returns the checked state of the 64 rounds starting at the given
+// round as a word, where the most significant bit is the state of the given
+// round. Rounds before firstUnchecked are set and rounds after lastChecked are
+// cleared.
+func (kr *KnownRounds) getWord(start id.Round) uint64 {
+	// All rounds are before firstUnchecked
+	if start < kr.firstUnchecked && kr.firstUnchecked-start >= 64 {
+		return ones
+	}
+
+	// Set the rounds before firstUnchecked, which may include rounds after
+	// lastChecked if the KnownRounds was truncated
+	var before uint64
+	if start < kr.firstUnchecked {
+		before = ^(ones >> uint(kr.firstUnchecked-start))
+	}
+
+	// All other rounds are after lastChecked or there is no buffer to read
+	// from
+	if start > kr.lastChecked || len(kr.bitStream) == 0 {
+		return before
+	}
+
+	// Read the bits starting at the position of the round; the bits may span
+	// two blocks
+	bin, offset := kr.bitStream.convertLoc(kr.getBitStreamPos(start))
+	word := kr.bitStream[bin] << uint(offset)
+	if offset > 0 {
+		word |= kr.bitStream[kr.bitStream.getBin(bin+1)] >> uint(64-offset)
+	}
+
+	// Clear the rounds after lastChecked
+	if kr.lastChecked-start < 63 {
+		word &= ^(ones >> uint(kr.lastChecked-start+1))
+	}
+
+	return word | before
+}
+
+// checkedEnd returns the last round that can be checked, which is the later of
+// lastChecked and the round before firstUnchecked. The round before
+// firstUnchecked is after lastChecked when the KnownRounds was truncated past
+// lastChecked.
+func (kr *KnownRounds) checkedEnd() id.Round {
+	if kr.firstUnchecked > kr.lastChecked+1 {
+		return kr.firstUnchecked - 1
+	}
+	return kr.lastChecked
+}
@@ -0,0 +1,230 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package knownRounds
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"testing"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Tests that KnownRounds.Union, KnownRounds.Intersect, and
+// KnownRounds.Difference produce the correct check state for every round when
+// combining randomly generated KnownRounds with different offsets and
+// capacities, including KnownRounds truncated past their lastChecked.
+func TestKnownRounds_SetOperations(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 200; i++ {
+		a := makeRandomKnownRounds(prng)
+		b := makeRandomKnownRounds(prng)
+
+		// Truncate some inputs past lastChecked so that the rounds between
+		// lastChecked and firstUnchecked are checked
+		if prng.Intn(3) == 0 {
+			a = a.Truncate(a.lastChecked + id.Round(prng.Intn(150)))
+		}
+		if prng.Intn(3) == 0 {
+			b = b.Truncate(b.lastChecked + id.Round(prng.Intn(150)))
+		}
+		aData, bData := a.Marshal(), b.Marshal()
+
+		union := a.Union(b)
+		intersect := a.Intersect(b)
+		difference := a.Difference(b)
+
+		start, end := a.firstUnchecked, a.checkedEnd()
+		if b.firstUnchecked < start {
+			start = b.firstUnchecked
+		}
+		if b.checkedEnd() > end {
+			end = b.checkedEnd()
+		}
+		if start > 70 {
+			start -= 70
+		}
+
+		for rid := start; rid <= end+70; rid++ {
+			if union.Checked(rid) != (a.Checked(rid) || b.Checked(rid)) {
+				t.Fatalf("Union has incorrect state for round %d (%d)."+
+					"\na: %+v\nb: %+v\nunion: %+v", rid, i, a, b, union)
+			}
+
+			if intersect.Checked(rid) != (a.Checked(rid) && b.Checked(rid)) {
+				t.Fatalf("Intersect has incorrect state for round %d (%d)."+
+					"\na: %+v\nb: %+v\nintersect: %+v", rid, i, a, b, intersect)
+			}
+
+			if rid >= b.firstUnchecked &&
+				difference.Checked(rid) != (a.Checked(rid) && !b.Checked(rid)) {
+				t.Fatalf("Difference has incorrect state for round %d (%d)."+
+					"\na: %+v\nb: %+v\ndifference: %+v",
+					rid, i, a, b, difference)
+			}
+		}
+
+		if !bytes.Equal(aData, a.Marshal()) || !bytes.Equal(bData, b.Marshal()) {
+			t.Errorf("Set operations modified their inputs (%d).", i)
+		}
+	}
+}
+
+// Tests that KnownRounds.Union returns a KnownRounds with the minimum capacity
+// and a consistent firstUnchecked and fuPos.
+func TestKnownRounds_Union(t *testing.T) {
+	a := &KnownRounds{
+		bitStream:      uint64Buff{0, math.MaxUint64, 0, math.MaxUint64, 0},
+		firstUnchecked: 75,
+		lastChecked:    191,
+		fuPos:          75,
+	}
+	b := &KnownRounds{
+		bitStream:      uint64Buff{0xFFFFFFFFFFFF0000},
+		firstUnchecked: 70,
+		lastChecked:    127,
+		fuPos:          6,
+	}
+
+	union := a.Union(b)
+
+	if union.firstUnchecked != 128 {
+		t.Errorf("Unexpected firstUnchecked.\nexpected: %d\nreceived: %d",
+			128, union.firstUnchecked)
+	}
+	if union.lastChecked != 191 {
+		t.Errorf("Unexpected lastChecked.\nexpected: %d\nreceived: %d",
+			191, union.lastChecked)
+	}
+	if union.getBitStreamPos(union.firstUnchecked) != union.fuPos {
+		t.Errorf("fuPos %d inconsistent with firstUnchecked %d.",
+			union.fuPos, union.firstUnchecked)
+	}
+	if len(union.bitStream) != 1 {
+		t.Errorf("Unexpected bit stream length.\nexpected: %d\nreceived: %d",
+			1, len(union.bitStream))
+	}
+}
+
+// Tests that the set operations handle KnownRounds whose windows do not
+// overlap.
+func TestKnownRounds_SetOperations_Disjoint(t *testing.T) {
+	a := NewKnownRound(64)
+	a.Forward(1000)
+	a.Check(1005)
+	b := NewKnownRound(64)
+	b.Forward(10)
+	b.Check(12)
+
+	union := a.Union(b)
+	if !union.Checked(999) || union.Checked(1000) || !union.Checked(1005) {
+		t.Errorf("Union has incorrect state: %+v", union)
+	}
+
+	intersect := a.Intersect(b)
+	if !intersect.Checked(9) || intersect.Checked(10) ||
+		!intersect.Checked(12) || intersect.Checked(13) ||
+		intersect.Checked(1005) {
+		t.Errorf("Intersect has incorrect state: %+v", intersect)
+	}
+
+	difference := b.Difference(a)
+	if difference.Checked(1000) || difference.Checked(1005) {
+		t.Errorf("Difference has incorrect state: %+v", difference)
+	}
+}
+
+// Tests that KnownRounds.Difference with an empty KnownRounds only allocates
+// the rounds from kr's firstUnchecked to its lastChecked.
+func TestKnownRounds_Difference_Capacity(t *testing.T) {
+	kr := NewKnownRound(128)
+	kr.Forward(50_000_000)
+	kr.Check(50_000_010)
+	kr.Check(50_000_100)
+
+	difference := kr.Difference(NewKnownRound(128))
+
+	if len(difference.bitStream) > 2 {
+		t.Errorf("Difference allocated too many blocks."+
+			"\nexpected: <= %d\nreceived: %d", 2, len(difference.bitStream))
+	}
+	for rid := id.Round(50_000_000); rid <= 50_000_110; rid++ {
+		if difference.Checked(rid) != kr.Checked(rid) {
+			t.Errorf("Difference has incorrect state for round %d.", rid)
+		}
+	}
+}
+
+// Tests that the set operations treat the rounds between lastChecked and
+// firstUnchecked of a truncated KnownRounds as checked.
+func TestKnownRounds_SetOperations_Truncated(t *testing.T) {
+	a := NewKnownRound(128)
+	a.Check(100)
+	a.Check(150)
+	a = a.Truncate(200)
+
+	b := NewKnownRound(320)
+	for rid := id.Round(0); rid < 300; rid++ {
+		if rid != 5 {
+			b.Check(rid)
+		}
+	}
+
+	intersect := a.Intersect(b)
+	if !intersect.Checked(170) || intersect.Checked(5) {
+		t.Errorf("Intersect has incorrect state: %+v", intersect)
+	}
+
+	c := NewKnownRound(64)
+	union := a.Union(c)
+	if !union.Checked(199) || union.Checked(200) {
+		t.Errorf("Union has incorrect state: %+v", union)
+	}
+
+	difference := a.Difference(c)
+	if !difference.Checked(170) || difference.Checked(200) {
+		t.Errorf("Difference has incorrect state: %+v", difference)
+	}
+}
+
+// Tests that KnownRounds.Difference does not report rounds that are checked in
+// other but before the firstUnchecked of kr as part of the difference.
+func TestKnownRounds_Difference_BeforeFirstUnchecked(t *testing.T) {
+	a := NewKnownRound(128)
+	a.Forward(100)
+	a.Check(120)
+	c := NewKnownRound(128)
+	c.Check(10)
+	c.Check(50)
+
+	difference := a.Difference(c)
+	if difference.Checked(50) {
+		t.Errorf("Round %d checked in both is in the difference.", 50)
+	}
+	if !difference.Checked(49) || !difference.Checked(120) ||
+		difference.Checked(121) {
+		t.Errorf("Difference has incorrect state: %+v", difference)
+	}
+}
+
+// makeRandomKnownRounds returns a KnownRounds with a random capacity, starting
+// round, and checked rounds.
+func makeRandomKnownRounds(prng *rand.Rand) *KnownRounds {
+	capacity := 64 * (1 + prng.Intn(6))
+	kr := NewKnownRound(capacity)
+	start := id.Round(prng.Intn(300))
+	kr.Forward(start)
+
+	for j := 0; j < prng.Intn(capacity); j++ {
+		kr.ForceCheck(start + id.Round(prng.Intn(capacity+50)))
+	}
+
+	return kr
+}
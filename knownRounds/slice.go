@@ -0,0 +1,46 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package knownRounds
+
+import (
+	"github.com/pkg/errors"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Slice returns a new KnownRounds containing the check state of the rounds
+// from start to end (inclusive) with the minimum capacity needed to hold them.
+// The returned KnownRounds does not share memory with kr.
+//
+// Because every round before firstUnchecked is considered checked, all rounds
+// before start are checked in the returned KnownRounds and its firstUnchecked
+// may be after start. Rounds after end are unchecked. An error is returned if
+// end is before start.
+func (kr *KnownRounds) Slice(start, end id.Round) (*KnownRounds, error) {
+	if end < start {
+		return nil, errors.Errorf("end round %d is before start round %d",
+			end, start)
+	}
+
+	// Rounds after lastChecked are unchecked and do not need to be stored,
+	// unless they are before firstUnchecked of a truncated KnownRounds
+	if checkedEnd := kr.checkedEnd(); end > checkedEnd {
+		end = checkedEnd
+	}
+
+	// Rounds before firstUnchecked are checked and do not need to be stored;
+	// the start is not moved past end so that rounds after end stay unchecked
+	if start < kr.firstUnchecked {
+		start = kr.firstUnchecked
+		if start > end+1 {
+			start = end + 1
+		}
+	}
+
+	return buildKnownRounds(start, end, kr.getWord), nil
+}
@@ -0,0 +1,167 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package knownRounds
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Tests that KnownRounds.Slice returns a KnownRounds with the same check state
+// as the original for every round in the range for randomly generated
+// KnownRounds and ranges.
+func TestKnownRounds_Slice(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 200; i++ {
+		kr := makeRandomKnownRounds(prng)
+		start := kr.firstUnchecked + id.Round(prng.Intn(kr.Len()))
+		if start > 50 {
+			start -= 50
+		}
+		end := start + id.Round(prng.Intn(kr.Len()))
+
+		slice, err := kr.Slice(start, end)
+		if err != nil {
+			t.Fatalf("Slice returned an error (%d): %+v", i, err)
+		}
+
+		for rid := start; rid <= end+64; rid++ {
+			expected := kr.Checked(rid) && rid <= end
+			if slice.Checked(rid) != expected {
+				t.Fatalf("Round %d has incorrect state (%d).\nexpected: %t"+
+					"\nreceived: %t\nkr: %+v\nslice: %+v",
+					rid, i, expected, slice.Checked(rid), kr, slice)
+			}
+		}
+
+		maxBlocks := int(end-start)/64 + 2
+		if len(slice.bitStream) > maxBlocks {
+			t.Errorf("Slice of %d rounds has %d blocks, expected at most %d "+
+				"(%d).", end-start+1, len(slice.bitStream), maxBlocks, i)
+		}
+	}
+}
+
+// Tests that KnownRounds.Slice produces a compact KnownRounds whose marshalled
+// form is smaller than the original.
+func TestKnownRounds_Slice_Compact(t *testing.T) {
+	kr := NewKnownRound(64 * 100)
+	for rid := id.Round(0); rid < 64*100; rid += 3 {
+		kr.Check(rid)
+	}
+
+	slice, err := kr.Slice(6000, 6100)
+	if err != nil {
+		t.Fatalf("Slice returned an error: %+v", err)
+	}
+
+	if slice.firstUnchecked != 6001 || slice.lastChecked != 6100 {
+		t.Errorf("Unexpected window [%d, %d], expected [%d, %d].",
+			slice.firstUnchecked, slice.lastChecked, 6001, 6100)
+	}
+
+	// Round 6000 is at position 48 in its block, so the 101 rounds span three
+	// blocks
+	if len(slice.bitStream) != 3 {
+		t.Errorf("Unexpected bit stream length.\nexpected: %d\nreceived: %d",
+			3, len(slice.bitStream))
+	}
+
+	if len(slice.Marshal()) >= len(kr.Marshal()) {
+		t.Errorf("Marshalled slice of length %d not smaller than original "+
+			"of length %d.", len(slice.Marshal()), len(kr.Marshal()))
+	}
+
+	// Modifying the slice must not modify the original
+	slice.Check(6001)
+	if kr.Checked(6001) {
+		t.Errorf("Modifying the slice modified the original.")
+	}
+}
+
+// Tests that KnownRounds.Slice does not allocate blocks for rounds before
+// firstUnchecked when start is far before it.
+func TestKnownRounds_Slice_LowStart(t *testing.T) {
+	kr := NewKnownRound(128)
+	kr.Forward(50_000_000)
+	kr.Check(50_000_010)
+	kr.Check(50_000_100)
+
+	slice, err := kr.Slice(0, 50_000_100)
+	if err != nil {
+		t.Fatalf("Slice returned an error: %+v", err)
+	}
+
+	if len(slice.bitStream) > 2 {
+		t.Errorf("Slice allocated too many blocks."+
+			"\nexpected: <= %d\nreceived: %d", 2, len(slice.bitStream))
+	}
+	for rid := id.Round(49_999_990); rid <= 50_000_110; rid++ {
+		if slice.Checked(rid) != kr.Checked(rid) {
+			t.Errorf("Slice has incorrect state for round %d.", rid)
+		}
+	}
+}
+
+// Tests that KnownRounds.Slice handles ranges entirely before firstUnchecked
+// and entirely after lastChecked.
+func TestKnownRounds_Slice_OutsideWindow(t *testing.T) {
+	kr := &KnownRounds{
+		bitStream:      uint64Buff{0, math.MaxUint64, 0, math.MaxUint64, 0},
+		firstUnchecked: 75,
+		lastChecked:    200,
+		fuPos:          11,
+	}
+
+	before, _ := kr.Slice(10, 20)
+	if !before.Checked(20) || before.Checked(21) {
+		t.Errorf("Unexpected state for slice before the window: %+v", before)
+	}
+
+	after, _ := kr.Slice(300, 400)
+	if !after.Checked(299) || after.Checked(300) || after.Checked(400) {
+		t.Errorf("Unexpected state for slice after the window: %+v", after)
+	}
+}
+
+// Tests that KnownRounds.Slice keeps the rounds between lastChecked and
+// firstUnchecked of a truncated KnownRounds checked.
+func TestKnownRounds_Slice_Truncated(t *testing.T) {
+	kr := NewKnownRound(128)
+	kr.Check(100)
+	kr.Check(150)
+	kr = kr.Truncate(200)
+
+	slice, err := kr.Slice(100, 180)
+	if err != nil {
+		t.Fatalf("Slice returned an error: %+v", err)
+	}
+
+	for rid := id.Round(90); rid <= 210; rid++ {
+		expected := kr.Checked(rid) && rid <= 180
+		if rid < 100 {
+			expected = true
+		}
+		if slice.Checked(rid) != expected {
+			t.Errorf("Slice has incorrect state for round %d."+
+				"\nexpected: %t\nreceived: %t", rid, expected, slice.Checked(rid))
+		}
+	}
+}
+
+// Error path: tests that KnownRounds.Slice returns an error when end is before
+// start.
+func TestKnownRounds_Slice_RangeError(t *testing.T) {
+	if _, err := NewKnownRound(64).Slice(10, 5); err == nil {
+		t.Errorf("Slice did not return an error when end is before start.")
+	}
+}
@@ -0,0 +1,105 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package knownRounds
+
+import (
+	"fmt"
+	"math/bits"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Stats contains statistics about the rounds in the window of a KnownRounds,
+// which starts at FirstUnchecked and ends at LastChecked.
+type Stats struct {
+	FirstUnchecked id.Round
+	LastChecked    id.Round
+
+	// Capacity is the max number of round IDs the buffer can hold.
+	Capacity int
+
+	// Checked and Unchecked are the number of checked and unchecked rounds in
+	// the window.
+	Checked   uint64
+	Unchecked uint64
+
+	// LongestGapStart and LongestGap are the first round and length of the
+	// longest run of unchecked rounds in the window.
+	LongestGapStart id.Round
+	LongestGap      uint64
+}
+
+// String returns a human-readable representation of the Stats. This function
+// adheres to the fmt.Stringer interface.
+func (s Stats) String() string {
+	return fmt.Sprintf("{window:[%d, %d] capacity:%d checked:%d "+
+		"unchecked:%d longestGap:%d@%d}", s.FirstUnchecked, s.LastChecked,
+		s.Capacity, s.Checked, s.Unchecked, s.LongestGap, s.LongestGapStart)
+}
+
+// Stats returns statistics on the checked and unchecked rounds in the window.
+func (kr *KnownRounds) Stats() Stats {
+	start, length := kr.LongestUncheckedGap()
+	checked := kr.CountChecked()
+	return Stats{
+		FirstUnchecked:  kr.firstUnchecked,
+		LastChecked:     kr.lastChecked,
+		Capacity:        kr.Len(),
+		Checked:         checked,
+		Unchecked:       kr.windowSize() - checked,
+		LongestGapStart: start,
+		LongestGap:      length,
+	}
+}
+
+// CountChecked returns the number of checked rounds between firstUnchecked and
+// lastChecked. The bits are counted a word at a time.
+func (kr *KnownRounds) CountChecked() uint64 {
+	if kr.lastChecked < kr.firstUnchecked || len(kr.bitStream) == 0 {
+		return 0
+	}
+
+	var count uint64
+	for rid := kr.firstUnchecked; ; rid += 64 {
+		count += uint64(bits.OnesCount64(kr.getWord(rid)))
+		if kr.lastChecked-rid < 64 {
+			break
+		}
+	}
+
+	return count
+}
+
+// CountUnchecked returns the number of unchecked rounds between firstUnchecked
+// and lastChecked.
+func (kr *KnownRounds) CountUnchecked() uint64 {
+	return kr.windowSize() - kr.CountChecked()
+}
+
+// LongestUncheckedGap returns the first round and the length of the longest
+// run of unchecked rounds between firstUnchecked and lastChecked. If there are
+// multiple runs of the same length, then the earliest is returned. If there
+// are no unchecked rounds, then the length is zero.
+func (kr *KnownRounds) LongestUncheckedGap() (start id.Round, length uint64) {
+	kr.IterateUnchecked(func(s, e id.Round) bool {
+		if uint64(e-s) > length {
+			start, length = s, uint64(e-s)
+		}
+		return true
+	})
+
+	return start, length
+}
+
+// windowSize returns the number of rounds from firstUnchecked to lastChecked.
+func (kr *KnownRounds) windowSize() uint64 {
+	if kr.lastChecked < kr.firstUnchecked || len(kr.bitStream) == 0 {
+		return 0
+	}
+	return uint64(kr.lastChecked-kr.firstUnchecked) + 1
+}
@@ -0,0 +1,94 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package knownRounds
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Tests that KnownRounds.Stats returns the expected statistics.
+func TestKnownRounds_Stats(t *testing.T) {
+	kr := &KnownRounds{
+		bitStream:      uint64Buff{0, math.MaxUint64, 0, math.MaxUint64, 0},
+		firstUnchecked: 75,
+		lastChecked:    200,
+		fuPos:          11,
+	}
+
+	expected := Stats{
+		FirstUnchecked:  75,
+		LastChecked:     200,
+		Capacity:        320,
+		Checked:         64,
+		Unchecked:       62,
+		LongestGapStart: 75,
+		LongestGap:      53,
+	}
+
+	if stats := kr.Stats(); stats != expected {
+		t.Errorf("Stats returned unexpected statistics."+
+			"\nexpected: %s\nreceived: %s", expected, stats)
+	}
+}
+
+// Tests that KnownRounds.CountChecked, KnownRounds.CountUnchecked, and
+// KnownRounds.LongestUncheckedGap match a round by round count for randomly
+// generated KnownRounds.
+func TestKnownRounds_CountChecked_Random(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 200; i++ {
+		kr := makeRandomKnownRounds(prng)
+
+		var checked, unchecked, gap, longestGap uint64
+		var gapStart, longestGapStart id.Round
+		for rid := kr.firstUnchecked; rid <= kr.lastChecked; rid++ {
+			if kr.Checked(rid) {
+				checked++
+				gap = 0
+				continue
+			}
+
+			unchecked++
+			if gap == 0 {
+				gapStart = rid
+			}
+			gap++
+			if gap > longestGap {
+				longestGap, longestGapStart = gap, gapStart
+			}
+		}
+
+		if kr.CountChecked() != checked {
+			t.Errorf("Unexpected checked count (%d).\nexpected: %d\nreceived: %d",
+				i, checked, kr.CountChecked())
+		}
+		if kr.CountUnchecked() != unchecked {
+			t.Errorf("Unexpected unchecked count (%d)."+
+				"\nexpected: %d\nreceived: %d", i, unchecked, kr.CountUnchecked())
+		}
+
+		start, length := kr.LongestUncheckedGap()
+		if start != longestGapStart || length != longestGap {
+			t.Errorf("Unexpected longest gap (%d).\nexpected: %d@%d"+
+				"\nreceived: %d@%d", i, longestGap, longestGapStart, length, start)
+		}
+	}
+}
+
+// Tests that the counts of a new KnownRounds are zero.
+func TestKnownRounds_Stats_NewKR(t *testing.T) {
+	stats := NewKnownRound(0).Stats()
+	if stats.Checked != 0 || stats.Unchecked != 0 || stats.LongestGap != 0 {
+		t.Errorf("Stats of an empty KnownRounds not zero: %s", stats)
+	}
+}
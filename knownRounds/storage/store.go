@@ -0,0 +1,558 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+// Package storage provides a file-backed knownRounds.KnownRounds that survives
+// crashes. The full state is periodically written to a checkpoint file and
+// every change in between is appended to a journal as a
+// knownRounds.KrChanges delta. On open, the latest checkpoint is loaded and the
+// journal is replayed up to the last complete record.
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+	jww "github.com/spf13/jwalterweatherman"
+
+	"gitlab.com/elixxir/primitives/knownRounds"
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// File names in the storage directory.
+const (
+	checkpointFile    = "checkpoint"
+	checkpointTmpFile = "checkpoint.tmp"
+	journalFile       = "journal"
+)
+
+// Size of the record header, which contains the payload length and checksum.
+const headerLen = 8
+
+// Size of the fixed fields at the start of the record payload.
+const payloadFieldsLen = 5 * 8
+
+// Params contains the parameters for a Store.
+type Params struct {
+	// CheckpointInterval is the number of records written to the journal
+	// before a new checkpoint is written and the journal is cleared.
+	CheckpointInterval int
+}
+
+// DefaultParams returns the default Params.
+func DefaultParams() Params {
+	return Params{
+		CheckpointInterval: 1000,
+	}
+}
+
+// Store is a thread-safe KnownRounds that persists every change to disk.
+type Store struct {
+	dir    string
+	params Params
+
+	kr      *knownRounds.KnownRounds
+	old     []uint64 // Bit stream as of the last written record
+	journal journalFileWriter
+	offset  int64  // End of the last complete record in the journal
+	seq     uint64 // Sequence number of the last written record
+	entries int    // Number of records in the journal
+
+	// True when the journal may contain incomplete data after offset that
+	// could not be removed, so a checkpoint must be written before the next
+	// record is appended
+	needsCheckpoint bool
+
+	mux sync.Mutex
+}
+
+// journalFileWriter is the subset of os.File used to write the journal.
+type journalFileWriter interface {
+	io.WriteCloser
+	io.Seeker
+	Sync() error
+	Truncate(size int64) error
+}
+
+// record is a single entry in the journal or checkpoint. The changes are
+// relative to the previous record or, for a checkpoint, to an empty bit
+// stream.
+//
+// Each record is written in the following format:
+// +--------+-------+--------------------------------------------+
+// | length | crc32 |                  payload                   |
+// | 4 bytes|4 bytes|              length bytes                  |
+// +--------+-------+--------------------------------------------+
+//
+// The payload contains the sequence number, firstUnchecked, lastChecked,
+// fuPos, and number of blocks as 8-byte little-endian integers followed by the
+// marshalled changes.
+type record struct {
+	seq            uint64
+	firstUnchecked id.Round
+	lastChecked    id.Round
+	fuPos          int
+	numBlocks      int
+	changes        knownRounds.KrChanges
+}
+
+// Open opens the Store in the given directory, creating the directory and a new
+// KnownRounds with the given capacity if it does not exist. If the directory
+// contains a checkpoint, then the KnownRounds is recovered from the checkpoint
+// and every complete journal record written after it, and roundCapacity is
+// ignored; the recovered KnownRounds keeps the capacity it was saved with. Any
+// incomplete or corrupt record at the end of the journal is discarded. An error
+// is returned if roundCapacity is less than 1.
+func Open(dir string, roundCapacity int, params Params) (*Store, error) {
+	if roundCapacity < 1 {
+		return nil, errors.Errorf(
+			"round capacity %d must be at least 1", roundCapacity)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, errors.Wrapf(err, "failed to create directory %q", dir)
+	}
+
+	s := &Store{dir: dir, params: params}
+
+	// Load the checkpoint or write a new one if none exists
+	cp, err := readCheckpoint(filepath.Join(dir, checkpointFile))
+	if os.IsNotExist(errors.Cause(err)) {
+		// A journal without a checkpoint cannot be replayed
+		err = os.Remove(filepath.Join(dir, journalFile))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, errors.Wrap(err, "failed to remove stale journal")
+		}
+
+		s.kr = knownRounds.NewKnownRound(roundCapacity)
+		if err = s.writeCheckpoint(); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	} else {
+		s.kr = knownRounds.NewFromParts(make([]uint64, cp.numBlocks),
+			cp.firstUnchecked, cp.lastChecked, 0)
+		if err = s.kr.ApplyChanges(cp.changes, cp.firstUnchecked,
+			cp.lastChecked, cp.fuPos); err != nil {
+			return nil, errors.Wrap(err, "failed to load checkpoint")
+		}
+		s.seq = cp.seq
+	}
+
+	// Replay the journal and open it for appending
+	if err = s.replayJournal(); err != nil {
+		return nil, err
+	}
+
+	s.old = s.kr.GetBitStream()
+
+	return s, nil
+}
+
+// Checked determines if the round has been checked.
+func (s *Store) Checked(rid id.Round) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.kr.Checked(rid)
+}
+
+// Check denotes a round has been checked and persists the change. An error is
+// returned if the round is outside the current scope or if writing fails, in
+// which case the round is not checked. See knownRounds.KnownRounds.TryCheck.
+func (s *Store) Check(rid id.Round) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.apply(func(kr *knownRounds.KnownRounds) error {
+		return kr.TryCheck(rid)
+	})
+}
+
+// ForceCheck denotes a round has been checked and persists the change. If
+// writing fails, then the round is not checked. See
+// knownRounds.KnownRounds.ForceCheck.
+func (s *Store) ForceCheck(rid id.Round) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.apply(func(kr *knownRounds.KnownRounds) error {
+		kr.ForceCheck(rid)
+		return nil
+	})
+}
+
+// Forward sets all rounds before the given round ID as checked and persists the
+// change. If writing fails, then the rounds are left unchanged.
+func (s *Store) Forward(rid id.Round) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.apply(func(kr *knownRounds.KnownRounds) error {
+		kr.Forward(rid)
+		return nil
+	})
+}
+
+// KnownRounds returns a copy of the stored KnownRounds.
+func (s *Store) KnownRounds() *knownRounds.KnownRounds {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.kr.Clone()
+}
+
+// Checkpoint writes the full KnownRounds to the checkpoint file and clears the
+// journal.
+func (s *Store) Checkpoint() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.checkpoint()
+}
+
+// Close closes the journal file. The Store must not be used after it is closed.
+func (s *Store) Close() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.journal.Close()
+}
+
+// apply makes the change to a copy of the KnownRounds and persists it. The copy
+// replaces the KnownRounds only once the change is written, so that a failed
+// change is not visible or included in the next record.
+func (s *Store) apply(change func(kr *knownRounds.KnownRounds) error) error {
+	prev := s.kr
+	s.kr = prev.Clone()
+
+	err := change(s.kr)
+	if err == nil {
+		err = s.persist()
+	}
+
+	if err != nil {
+		s.kr = prev
+	}
+
+	return err
+}
+
+// persist appends the changes since the last record to the journal. If the bit
+// stream changed size or the journal has reached the checkpoint interval, then
+// a checkpoint is written instead.
+func (s *Store) persist() error {
+	bitStream := s.kr.GetBitStream()
+	if len(bitStream) != len(s.old) ||
+		s.entries >= s.params.CheckpointInterval || s.needsCheckpoint {
+		return s.checkpoint()
+	}
+
+	changes, fu, lc, fuPos, err := s.kr.OutputBuffChanges(s.old)
+	if err != nil {
+		return err
+	}
+
+	r := record{
+		seq:            s.seq + 1,
+		firstUnchecked: fu,
+		lastChecked:    lc,
+		fuPos:          fuPos,
+		numBlocks:      len(bitStream),
+		changes:        changes,
+	}
+
+	data := r.marshal()
+	if _, err = s.journal.Write(data); err != nil {
+		s.discardIncompleteRecord()
+		return errors.Wrap(err, "failed to write to journal")
+	} else if err = s.journal.Sync(); err != nil {
+		s.discardIncompleteRecord()
+		return errors.Wrap(err, "failed to sync journal")
+	}
+
+	s.seq++
+	s.entries++
+	s.offset += int64(len(data))
+	s.old = bitStream
+
+	return nil
+}
+
+// discardIncompleteRecord removes any data written to the journal after the
+// last complete record so that the next record is not appended after it,
+// which would cause it to be discarded on replay. If the data cannot be
+// removed, then a checkpoint is written on the next change instead.
+func (s *Store) discardIncompleteRecord() {
+	err := s.journal.Truncate(s.offset)
+	if err == nil {
+		_, err = s.journal.Seek(s.offset, io.SeekStart)
+	}
+
+	if err != nil {
+		jww.WARN.Printf("Failed to remove incomplete journal record; a "+
+			"checkpoint will be written on the next change: %+v", err)
+		s.needsCheckpoint = true
+	}
+}
+
+// checkpoint writes the checkpoint and then truncates the journal. If writing
+// the checkpoint fails, then the sequence number is not reused, since the new
+// checkpoint may already be on disk, and another checkpoint is written on the
+// next change.
+func (s *Store) checkpoint() error {
+	s.seq++
+	if err := s.writeCheckpoint(); err != nil {
+		s.needsCheckpoint = true
+		return err
+	}
+
+	s.entries = 0
+	s.old = s.kr.GetBitStream()
+
+	// The checkpoint includes every change, so the journal records are no
+	// longer needed. If clearing the journal fails, its records are skipped
+	// on replay because they are older than the checkpoint, but the journal
+	// must be cleared before the next record is appended, so another
+	// checkpoint is written on the next change instead.
+	err := s.journal.Truncate(0)
+	if err == nil {
+		_, err = s.journal.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		err = s.journal.Sync()
+	}
+
+	if err != nil {
+		jww.WARN.Printf("Failed to clear journal after checkpoint; another "+
+			"checkpoint will be written on the next change: %+v", err)
+		s.needsCheckpoint = true
+	} else {
+		s.offset = 0
+		s.needsCheckpoint = false
+	}
+
+	return nil
+}
+
+// writeCheckpoint atomically replaces the checkpoint file with the current
+// KnownRounds by writing to a temporary file and renaming it.
+func (s *Store) writeCheckpoint() error {
+	bitStream := s.kr.GetBitStream()
+	changes := make(knownRounds.KrChanges)
+	for i, word := range bitStream {
+		if word != 0 {
+			changes[i] = word
+		}
+	}
+
+	r := record{
+		seq:            s.seq,
+		firstUnchecked: s.kr.GetFirstUnchecked(),
+		lastChecked:    s.kr.GetLastChecked(),
+		fuPos:          s.kr.GetFuPos(),
+		numBlocks:      len(bitStream),
+		changes:        changes,
+	}
+
+	tmpPath := filepath.Join(s.dir, checkpointTmpFile)
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to create checkpoint")
+	}
+
+	if _, err = f.Write(r.marshal()); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "failed to write checkpoint")
+	} else if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "failed to sync checkpoint")
+	} else if err = f.Close(); err != nil {
+		return errors.Wrap(err, "failed to close checkpoint")
+	}
+
+	err = os.Rename(tmpPath, filepath.Join(s.dir, checkpointFile))
+	if err != nil {
+		return errors.Wrap(err, "failed to replace checkpoint")
+	}
+
+	return syncDir(s.dir)
+}
+
+// replayJournal applies every complete record in the journal written after the
+// checkpoint, truncates any incomplete or corrupt data at the end of the
+// journal, and opens the journal for appending.
+func (s *Store) replayJournal() error {
+	path := filepath.Join(s.dir, journalFile)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return errors.Wrap(err, "failed to open journal")
+	}
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "failed to read journal")
+	}
+
+	// Apply records until the end of the journal or the first bad record
+	var offset int
+	for offset < len(data) {
+		r, n, err := unmarshalRecord(data[offset:])
+		if err != nil {
+			jww.WARN.Printf("Discarding journal from offset %d of %d: %+v",
+				offset, len(data), err)
+			break
+		}
+
+		// Skip records already included in the checkpoint
+		if r.seq <= s.seq {
+			offset += n
+			continue
+		} else if r.seq != s.seq+1 || r.numBlocks != len(s.kr.GetBitStream()) {
+			jww.WARN.Printf("Discarding journal from offset %d of %d: "+
+				"record %d does not follow record %d", offset, len(data),
+				r.seq, s.seq)
+			break
+		}
+
+		err = s.kr.ApplyChanges(
+			r.changes, r.firstUnchecked, r.lastChecked, r.fuPos)
+		if err != nil {
+			jww.WARN.Printf("Discarding journal from offset %d of %d: %+v",
+				offset, len(data), err)
+			break
+		}
+
+		s.seq = r.seq
+		s.entries++
+		offset += n
+	}
+
+	// Remove the bad data so that new records are appended after the last
+	// good record
+	if offset < len(data) {
+		if err = f.Truncate(int64(offset)); err != nil {
+			_ = f.Close()
+			return errors.Wrap(err, "failed to truncate journal")
+		} else if err = f.Sync(); err != nil {
+			_ = f.Close()
+			return errors.Wrap(err, "failed to sync journal")
+		}
+	}
+
+	if _, err = f.Seek(int64(offset), io.SeekStart); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "failed to seek journal")
+	}
+
+	s.journal = f
+	s.offset = int64(offset)
+	return nil
+}
+
+// readCheckpoint reads and decodes the checkpoint file.
+func readCheckpoint(path string) (record, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return record{}, errors.WithStack(err)
+	}
+
+	r, n, err := unmarshalRecord(data)
+	if err != nil {
+		return record{}, errors.Wrap(err, "failed to read checkpoint")
+	} else if n != len(data) {
+		return record{}, errors.Errorf("extraneous data of length %d found "+
+			"at end of checkpoint", len(data)-n)
+	}
+
+	return r, nil
+}
+
+// marshal encodes the record with its header.
+func (r record) marshal() []byte {
+	var payload bytes.Buffer
+	b := make([]byte, 8)
+	for _, v := range []uint64{r.seq, uint64(r.firstUnchecked),
+		uint64(r.lastChecked), uint64(r.fuPos), uint64(r.numBlocks)} {
+		binary.LittleEndian.PutUint64(b, v)
+		payload.Write(b)
+	}
+	payload.Write(r.changes.Marshal())
+
+	data := make([]byte, headerLen, headerLen+payload.Len())
+	binary.LittleEndian.PutUint32(data[:4], uint32(payload.Len()))
+	binary.LittleEndian.PutUint32(data[4:], crc32.ChecksumIEEE(payload.Bytes()))
+
+	return append(data, payload.Bytes()...)
+}
+
+// unmarshalRecord decodes the record at the start of the data and returns it
+// and the number of bytes it used. An error is returned if the record is
+// incomplete or its checksum does not match.
+func unmarshalRecord(data []byte) (record, int, error) {
+	if len(data) < headerLen {
+		return record{}, 0, errors.Errorf("incomplete record header of "+
+			"length %d", len(data))
+	}
+
+	length := binary.LittleEndian.Uint32(data[:4])
+	checksum := binary.LittleEndian.Uint32(data[4:headerLen])
+	if uint64(length) > uint64(len(data)-headerLen) {
+		return record{}, 0, errors.Errorf("incomplete record: expected %d "+
+			"bytes, found %d", length, len(data)-headerLen)
+	} else if length < payloadFieldsLen {
+		return record{}, 0, errors.Errorf("record of length %d smaller than "+
+			"minimum %d", length, payloadFieldsLen)
+	}
+
+	payload := data[headerLen : headerLen+int(length)]
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return record{}, 0, errors.New("record checksum mismatch")
+	}
+
+	changes, err := knownRounds.UnmarshalKrChanges(payload[payloadFieldsLen:])
+	if err != nil {
+		return record{}, 0, err
+	}
+
+	r := record{
+		seq:            binary.LittleEndian.Uint64(payload[0:8]),
+		firstUnchecked: id.Round(binary.LittleEndian.Uint64(payload[8:16])),
+		lastChecked:    id.Round(binary.LittleEndian.Uint64(payload[16:24])),
+		fuPos:          int(binary.LittleEndian.Uint64(payload[24:32])),
+		numBlocks:      int(binary.LittleEndian.Uint64(payload[32:40])),
+		changes:        changes,
+	}
+
+	if r.numBlocks < 0 || r.numBlocks > knownRounds.MaxUnmarshalBlocks {
+		return record{}, 0, errors.Errorf("invalid number of blocks %d",
+			r.numBlocks)
+	}
+
+	return r, headerLen + int(length), nil
+}
+
+// syncDir syncs the directory so that a rename within it is durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return errors.Wrap(err, "failed to open directory")
+	}
+	defer func() { _ = d.Close() }()
+
+	if err = d.Sync(); err != nil {
+		return errors.Wrap(err, "failed to sync directory")
+	}
+
+	return nil
+}
@@ -0,0 +1,463 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package storage
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gitlab.com/elixxir/primitives/knownRounds"
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Tests that a Store reopened after being closed contains the same
+// KnownRounds.
+func TestOpen_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	prng := rand.New(rand.NewSource(42))
+
+	s, err := Open(dir, 512, DefaultParams())
+	if err != nil {
+		t.Fatalf("Failed to open store: %+v", err)
+	}
+
+	checkRandom(t, s, prng, 200)
+	expected := s.KnownRounds()
+
+	if err = s.Close(); err != nil {
+		t.Fatalf("Failed to close store: %+v", err)
+	}
+
+	s, err = Open(dir, 512, DefaultParams())
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %+v", err)
+	}
+	defer closeStore(t, s)
+
+	if !reflect.DeepEqual(expected, s.KnownRounds()) {
+		t.Errorf("Reopened KnownRounds does not match original."+
+			"\nexpected: %+v\nreceived: %+v", expected, s.KnownRounds())
+	}
+}
+
+// Error path: tests that Open returns an error when the round capacity is less
+// than 1, since a KnownRounds without any blocks cannot be reopened.
+func TestOpen_RoundCapacityError(t *testing.T) {
+	for _, roundCapacity := range []int{0, -64} {
+		_, err := Open(t.TempDir(), roundCapacity, DefaultParams())
+		if err == nil {
+			t.Errorf("Open did not return an error for round capacity %d.",
+				roundCapacity)
+		}
+	}
+}
+
+// Tests that a journal cut off at every point inside its last record recovers
+// the state from before that record and that new changes written after
+// recovery are kept.
+func TestOpen_TornJournalWrite(t *testing.T) {
+	src := t.TempDir()
+	prng := rand.New(rand.NewSource(42))
+
+	s, err := Open(src, 512, DefaultParams())
+	if err != nil {
+		t.Fatalf("Failed to open store: %+v", err)
+	}
+	checkRandom(t, s, prng, 50)
+	expected := s.KnownRounds()
+	journalLen := fileSize(t, filepath.Join(src, journalFile))
+
+	checkRandom(t, s, prng, 1)
+	closeStore(t, s)
+	journal := readFile(t, filepath.Join(src, journalFile))
+
+	for cut := journalLen; cut < int64(len(journal)); cut++ {
+		dir := t.TempDir()
+		copyFile(t, filepath.Join(src, checkpointFile),
+			filepath.Join(dir, checkpointFile))
+		writeFile(t, filepath.Join(dir, journalFile), journal[:cut])
+
+		s, err = Open(dir, 512, DefaultParams())
+		if err != nil {
+			t.Fatalf("Failed to open store with journal cut at %d: %+v",
+				cut, err)
+		}
+
+		if !reflect.DeepEqual(expected, s.KnownRounds()) {
+			t.Errorf("Recovered KnownRounds with journal cut at %d does not "+
+				"match expected.\nexpected: %+v\nreceived: %+v",
+				cut, expected, s.KnownRounds())
+		}
+
+		if size := fileSize(t, filepath.Join(dir, journalFile)); size != journalLen {
+			t.Errorf("Journal cut at %d not truncated to last good record."+
+				"\nexpected: %d\nreceived: %d", cut, journalLen, size)
+		}
+
+		// Ensure new records are readable after the recovered ones
+		if err = s.Check(expected.GetLastChecked() + 1); err != nil {
+			t.Fatalf("Failed to check round: %+v", err)
+		}
+		afterRecovery := s.KnownRounds()
+		closeStore(t, s)
+
+		s, err = Open(dir, 512, DefaultParams())
+		if err != nil {
+			t.Fatalf("Failed to reopen store: %+v", err)
+		}
+		if !reflect.DeepEqual(afterRecovery, s.KnownRounds()) {
+			t.Errorf("Change written after recovery with journal cut at %d "+
+				"lost.\nexpected: %+v\nreceived: %+v",
+				cut, afterRecovery, s.KnownRounds())
+		}
+		closeStore(t, s)
+	}
+}
+
+// Tests that a corrupt byte in a journal record discards that record and every
+// record after it.
+func TestOpen_CorruptJournalRecord(t *testing.T) {
+	dir := t.TempDir()
+	prng := rand.New(rand.NewSource(42))
+
+	s, err := Open(dir, 512, DefaultParams())
+	if err != nil {
+		t.Fatalf("Failed to open store: %+v", err)
+	}
+	checkRandom(t, s, prng, 20)
+	expected := s.KnownRounds()
+	journalLen := fileSize(t, filepath.Join(dir, journalFile))
+	checkRandom(t, s, prng, 5)
+	closeStore(t, s)
+
+	journal := readFile(t, filepath.Join(dir, journalFile))
+	journal[journalLen+headerLen+1] ^= 0xFF
+	writeFile(t, filepath.Join(dir, journalFile), journal)
+
+	s, err = Open(dir, 512, DefaultParams())
+	if err != nil {
+		t.Fatalf("Failed to open store: %+v", err)
+	}
+	defer closeStore(t, s)
+
+	if !reflect.DeepEqual(expected, s.KnownRounds()) {
+		t.Errorf("Recovered KnownRounds does not match expected."+
+			"\nexpected: %+v\nreceived: %+v", expected, s.KnownRounds())
+	}
+}
+
+// Tests that the journal is cleared every Params.CheckpointInterval records
+// and that the state is recovered from the checkpoint and the remaining
+// journal.
+func TestStore_CheckpointInterval(t *testing.T) {
+	dir := t.TempDir()
+	prng := rand.New(rand.NewSource(42))
+	params := Params{CheckpointInterval: 3}
+
+	s, err := Open(dir, 512, params)
+	if err != nil {
+		t.Fatalf("Failed to open store: %+v", err)
+	}
+
+	for i := 0; i < 20; i++ {
+		checkRandom(t, s, prng, 1)
+		if s.entries > params.CheckpointInterval {
+			t.Errorf("Journal has %d records; expected at most %d.",
+				s.entries, params.CheckpointInterval)
+		}
+	}
+	expected := s.KnownRounds()
+	closeStore(t, s)
+
+	s, err = Open(dir, 512, params)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %+v", err)
+	}
+	defer closeStore(t, s)
+
+	if !reflect.DeepEqual(expected, s.KnownRounds()) {
+		t.Errorf("Reopened KnownRounds does not match original."+
+			"\nexpected: %+v\nreceived: %+v", expected, s.KnownRounds())
+	}
+}
+
+// Tests that a crash after a new checkpoint is written but before the journal
+// is cleared does not replay the old journal records on top of the checkpoint.
+func TestStore_Checkpoint_StaleJournal(t *testing.T) {
+	dir := t.TempDir()
+	prng := rand.New(rand.NewSource(42))
+
+	s, err := Open(dir, 512, DefaultParams())
+	if err != nil {
+		t.Fatalf("Failed to open store: %+v", err)
+	}
+	checkRandom(t, s, prng, 30)
+	staleJournal := readFile(t, filepath.Join(dir, journalFile))
+
+	// Forward past the rounds in the stale journal so that replaying them
+	// would change the state
+	if err = s.Forward(s.KnownRounds().GetLastChecked() + 100); err != nil {
+		t.Fatalf("Failed to forward: %+v", err)
+	}
+	if err = s.Checkpoint(); err != nil {
+		t.Fatalf("Failed to write checkpoint: %+v", err)
+	}
+	expected := s.KnownRounds()
+	closeStore(t, s)
+
+	writeFile(t, filepath.Join(dir, journalFile), staleJournal)
+
+	s, err = Open(dir, 512, DefaultParams())
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %+v", err)
+	}
+	defer closeStore(t, s)
+
+	if !reflect.DeepEqual(expected, s.KnownRounds()) {
+		t.Errorf("Reopened KnownRounds does not match checkpoint."+
+			"\nexpected: %+v\nreceived: %+v", expected, s.KnownRounds())
+	}
+}
+
+// Tests that a partially written temporary checkpoint left by a crash is
+// ignored.
+func TestOpen_TornCheckpointWrite(t *testing.T) {
+	dir := t.TempDir()
+	prng := rand.New(rand.NewSource(42))
+
+	s, err := Open(dir, 512, DefaultParams())
+	if err != nil {
+		t.Fatalf("Failed to open store: %+v", err)
+	}
+	checkRandom(t, s, prng, 30)
+	expected := s.KnownRounds()
+	closeStore(t, s)
+
+	checkpoint := readFile(t, filepath.Join(dir, checkpointFile))
+	writeFile(t, filepath.Join(dir, checkpointTmpFile),
+		checkpoint[:len(checkpoint)/2])
+
+	s, err = Open(dir, 512, DefaultParams())
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %+v", err)
+	}
+	defer closeStore(t, s)
+
+	if !reflect.DeepEqual(expected, s.KnownRounds()) {
+		t.Errorf("Reopened KnownRounds does not match original."+
+			"\nexpected: %+v\nreceived: %+v", expected, s.KnownRounds())
+	}
+}
+
+// Error path: Tests that Open returns an error for a corrupt checkpoint.
+func TestOpen_CorruptCheckpointError(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := Open(dir, 512, DefaultParams())
+	if err != nil {
+		t.Fatalf("Failed to open store: %+v", err)
+	}
+	closeStore(t, s)
+
+	checkpoint := readFile(t, filepath.Join(dir, checkpointFile))
+	writeFile(t, filepath.Join(dir, checkpointFile),
+		checkpoint[:len(checkpoint)-1])
+
+	_, err = Open(dir, 512, DefaultParams())
+	if err == nil {
+		t.Error("Open did not return an error for a corrupt checkpoint.")
+	}
+}
+
+// Tests that a journal without a checkpoint is not replayed.
+func TestOpen_JournalWithoutCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	prng := rand.New(rand.NewSource(42))
+
+	s, err := Open(dir, 512, DefaultParams())
+	if err != nil {
+		t.Fatalf("Failed to open store: %+v", err)
+	}
+	checkRandom(t, s, prng, 30)
+	closeStore(t, s)
+
+	if err = os.Remove(filepath.Join(dir, checkpointFile)); err != nil {
+		t.Fatalf("Failed to remove checkpoint: %+v", err)
+	}
+
+	s, err = Open(dir, 512, DefaultParams())
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %+v", err)
+	}
+	defer closeStore(t, s)
+
+	expected := knownRounds.NewKnownRound(512)
+	if !reflect.DeepEqual(expected, s.KnownRounds()) {
+		t.Errorf("Reopened KnownRounds is not new."+
+			"\nexpected: %+v\nreceived: %+v", expected, s.KnownRounds())
+	}
+}
+
+// Error path: Tests that Store.Check returns an error for a round outside the
+// scope of the buffer and does not write a record.
+func TestStore_Check_OutOfScopeError(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := Open(dir, 64, DefaultParams())
+	if err != nil {
+		t.Fatalf("Failed to open store: %+v", err)
+	}
+	defer closeStore(t, s)
+
+	if err = s.Check(1000); err == nil {
+		t.Error("Check did not return an error for an out of scope round.")
+	}
+
+	if s.entries != 0 {
+		t.Errorf("Journal has %d records after failed check.", s.entries)
+	}
+}
+
+// Tests that a change whose journal write or sync fails is not applied and that
+// a change persisted after it survives a reopen. This covers both removing the
+// incomplete record and, when that also fails, falling back to a checkpoint.
+func TestStore_JournalWriteError(t *testing.T) {
+	tests := []struct {
+		name string
+		fj   faultyJournal
+	}{
+		{"short write", faultyJournal{shortWrite: true}},
+		{"sync", faultyJournal{failSync: true}},
+		{"short write and truncate",
+			faultyJournal{shortWrite: true, failTruncate: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			prng := rand.New(rand.NewSource(42))
+
+			s, err := Open(dir, 512, DefaultParams())
+			if err != nil {
+				t.Fatalf("Failed to open store: %+v", err)
+			}
+			checkRandom(t, s, prng, 20)
+
+			fj := tt.fj
+			fj.journalFileWriter = s.journal
+			s.journal = &fj
+
+			lc := s.KnownRounds().GetLastChecked()
+			if err = s.Check(lc + 1); err == nil {
+				t.Fatal("Check did not return an error for a failed write.")
+			}
+			if s.Checked(lc + 1) {
+				t.Errorf("Round %d checked after failed write.", lc+1)
+			}
+			if err = s.Check(lc + 3); err != nil {
+				t.Fatalf("Failed to check round after failed write: %+v", err)
+			}
+			expected := s.KnownRounds()
+			closeStore(t, s)
+
+			s, err = Open(dir, 512, DefaultParams())
+			if err != nil {
+				t.Fatalf("Failed to reopen store: %+v", err)
+			}
+			defer closeStore(t, s)
+
+			if !expected.Equal(s.KnownRounds()) {
+				t.Errorf("Reopened KnownRounds does not match."+
+					"\nexpected: %s\nreceived: %s", expected, s.KnownRounds())
+			}
+			if s.Checked(lc+1) || !s.Checked(lc+3) {
+				t.Errorf("Round %d checked or round %d not checked after "+
+					"reopen.", lc+1, lc+3)
+			}
+		})
+	}
+}
+
+// faultyJournal is a journal that fails the first write or sync. A failed
+// write writes half the data. Truncate can be made to always fail.
+type faultyJournal struct {
+	journalFileWriter
+	shortWrite, failSync, failTruncate bool
+}
+
+func (fj *faultyJournal) Write(p []byte) (int, error) {
+	if fj.shortWrite {
+		fj.shortWrite = false
+		n, _ := fj.journalFileWriter.Write(p[:len(p)/2])
+		return n, errors.New("short write")
+	}
+	return fj.journalFileWriter.Write(p)
+}
+
+func (fj *faultyJournal) Sync() error {
+	if fj.failSync {
+		fj.failSync = false
+		return errors.New("sync failed")
+	}
+	return fj.journalFileWriter.Sync()
+}
+
+func (fj *faultyJournal) Truncate(size int64) error {
+	if fj.failTruncate {
+		return errors.New("truncate failed")
+	}
+	return fj.journalFileWriter.Truncate(size)
+}
+
+// checkRandom checks n random rounds near the end of the window, forcing the
+// buffer to move forward occasionally.
+func checkRandom(t *testing.T, s *Store, prng *rand.Rand, n int) {
+	for i := 0; i < n; i++ {
+		kr := s.KnownRounds()
+		rid := kr.GetFirstUnchecked() + id.Round(prng.Intn(kr.Len()+kr.Len()/4))
+		if err := s.ForceCheck(rid); err != nil {
+			t.Fatalf("Failed to check round %d: %+v", rid, err)
+		}
+	}
+}
+
+func closeStore(t *testing.T, s *Store) {
+	if err := s.Close(); err != nil {
+		t.Fatalf("Failed to close store: %+v", err)
+	}
+}
+
+func readFile(t *testing.T, path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %+v", path, err)
+	}
+	return data
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Failed to write %s: %+v", path, err)
+	}
+}
+
+func copyFile(t *testing.T, src, dst string) {
+	writeFile(t, dst, readFile(t, src))
+}
+
+func fileSize(t *testing.T, path string) int64 {
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat %s: %+v", path, err)
+	}
+	return fi.Size()
+}
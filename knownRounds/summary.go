@@ -0,0 +1,188 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package knownRounds
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/pkg/errors"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Current encoding version of a marshalled Summary.
+const summaryVersion = 0
+
+// Length of the marshalled Summary header, which contains the version,
+// firstUnchecked, lastChecked, and number of hashes.
+const summaryHeaderLen = 1 + 8 + 8 + 1
+
+// Maximum number of hashes used per round in a Summary.
+const maxSummaryHashes = 16
+
+// Summary is a fixed-size probabilistic digest of the checked rounds of a
+// KnownRounds. It is a Bloom filter keyed by round ID containing every checked
+// round in the window between firstUnchecked and lastChecked. Rounds before the
+// window are known to be checked and rounds after it are known to be
+// unchecked, so only rounds in the window can be false positives.
+//
+// A Summary is much smaller than a marshalled KnownRounds for wide windows and
+// can be used by peers to find which rounds they need to sync before
+// exchanging full bit streams.
+type Summary struct {
+	firstUnchecked id.Round
+	lastChecked    id.Round
+	numHashes      int
+	bits           []uint64
+}
+
+// Summary returns a Summary of the checked rounds with a filter of the given
+// size in bytes, rounded up to a multiple of 8. The number of hashes is chosen
+// to minimise the false positive rate for the number of checked rounds.
+func (kr *KnownRounds) Summary(size int) *Summary {
+	numWords := (size + 7) / 8
+	if numWords < 1 {
+		numWords = 1
+	}
+
+	s := &Summary{
+		firstUnchecked: kr.firstUnchecked,
+		lastChecked:    kr.lastChecked,
+		numHashes:      1,
+		bits:           make([]uint64, numWords),
+	}
+
+	// The optimal number of hashes is (m/n)ln(2) for m bits and n entries
+	if n := kr.CountChecked(); n > 0 {
+		k := math.Round(float64(numWords*64) / float64(n) * math.Ln2)
+		s.numHashes = int(math.Max(1, math.Min(k, maxSummaryHashes)))
+	}
+
+	kr.Iterate(func(start, end id.Round) bool {
+		for rid := start; rid < end; rid++ {
+			s.add(rid)
+		}
+		return true
+	})
+
+	return s
+}
+
+// MightBeChecked returns false if the round is definitely unchecked in the
+// summarised KnownRounds and true if it is probably checked. Rounds before the
+// window are always checked and rounds after the window are never checked.
+func (s *Summary) MightBeChecked(rid id.Round) bool {
+	if rid < s.firstUnchecked {
+		return true
+	} else if rid > s.lastChecked {
+		return false
+	}
+
+	m := uint64(len(s.bits) * 64)
+	h1, h2 := summaryHashes(rid)
+	for i := 0; i < s.numHashes; i++ {
+		bit := (h1 + uint64(i)*h2) % m
+		if s.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// GetFirstUnchecked returns the first unchecked round of the summarised
+// KnownRounds.
+func (s *Summary) GetFirstUnchecked() id.Round { return s.firstUnchecked }
+
+// GetLastChecked returns the last checked round of the summarised KnownRounds.
+func (s *Summary) GetLastChecked() id.Round { return s.lastChecked }
+
+// Size returns the size of the filter in bytes.
+func (s *Summary) Size() int { return len(s.bits) * 8 }
+
+// Marshal encodes the Summary into a byte slice.
+//
+// The data is encoded in the following structure:
+// +---------+----------------+-------------+-----------+------------+
+// | version | firstUnchecked | lastChecked | numHashes |   filter   |
+// | 1 byte  |    8 bytes     |   8 bytes   |  1 byte   | 8*n bytes  |
+// +---------+----------------+-------------+-----------+------------+
+func (s *Summary) Marshal() []byte {
+	data := make([]byte, summaryHeaderLen, summaryHeaderLen+len(s.bits)*8)
+	data[0] = summaryVersion
+	binary.LittleEndian.PutUint64(data[1:9], uint64(s.firstUnchecked))
+	binary.LittleEndian.PutUint64(data[9:17], uint64(s.lastChecked))
+	data[17] = uint8(s.numHashes)
+
+	for _, word := range s.bits {
+		data = append(data, write8Bytes(word)...)
+	}
+
+	return data
+}
+
+// UnmarshalSummary decodes the byte slice produced by Summary.Marshal.
+// Malformed data returns an error wrapping ErrCorruptEncoding.
+func UnmarshalSummary(data []byte) (*Summary, error) {
+	if len(data) < summaryHeaderLen+8 {
+		return nil, errors.Wrapf(ErrCorruptEncoding, "Summary data of length "+
+			"%d smaller than minimum %d", len(data), summaryHeaderLen+8)
+	} else if data[0] != summaryVersion {
+		return nil, errors.Wrapf(ErrCorruptEncoding,
+			"Summary encoding version %d unrecognized", data[0])
+	} else if (len(data)-summaryHeaderLen)%8 != 0 {
+		return nil, errors.Wrapf(ErrCorruptEncoding, "Summary filter of "+
+			"length %d not a multiple of 8", len(data)-summaryHeaderLen)
+	}
+
+	s := &Summary{
+		firstUnchecked: id.Round(binary.LittleEndian.Uint64(data[1:9])),
+		lastChecked:    id.Round(binary.LittleEndian.Uint64(data[9:17])),
+		numHashes:      int(data[17]),
+		bits:           make([]uint64, (len(data)-summaryHeaderLen)/8),
+	}
+
+	if s.numHashes < 1 || s.numHashes > maxSummaryHashes {
+		return nil, errors.Wrapf(ErrCorruptEncoding, "Summary number of "+
+			"hashes %d outside range [1, %d]", s.numHashes, maxSummaryHashes)
+	}
+
+	for i := range s.bits {
+		s.bits[i] = binary.LittleEndian.Uint64(data[summaryHeaderLen+i*8:])
+	}
+
+	return s, nil
+}
+
+// add sets the bits for the round in the filter.
+func (s *Summary) add(rid id.Round) {
+	m := uint64(len(s.bits) * 64)
+	h1, h2 := summaryHashes(rid)
+	for i := 0; i < s.numHashes; i++ {
+		bit := (h1 + uint64(i)*h2) % m
+		s.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// summaryHashes returns the two hashes of the round used to derive the filter
+// positions by double hashing. The hashes are calculated using the SplitMix64
+// finaliser, which is enough to spread sequential round IDs across the filter.
+func summaryHashes(rid id.Round) (uint64, uint64) {
+	h := uint64(rid)
+	h1 := mix64(h + 0x9E3779B97F4A7C15)
+	h2 := mix64(h1) | 1
+	return h1, h2
+}
+
+// mix64 is the SplitMix64 finaliser.
+func mix64(z uint64) uint64 {
+	z = (z ^ (z >> 30)) * 0xBF58476D1CE4E5B9
+	z = (z ^ (z >> 27)) * 0x94D049BB133111EB
+	return z ^ (z >> 31)
+}
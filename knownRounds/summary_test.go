@@ -0,0 +1,135 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package knownRounds
+
+import (
+	"errors"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Tests that KnownRounds.Summary produces a Summary with no false negatives for
+// random KnownRounds and that rounds outside the window are reported exactly.
+func TestKnownRounds_Summary(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 100; i++ {
+		kr := makeRandomKnownRounds(prng)
+		s := kr.Summary(64 + prng.Intn(256))
+
+		low := id.Round(0)
+		if kr.firstUnchecked > 100 {
+			low = kr.firstUnchecked - 100
+		}
+		for rid := low; rid <= kr.lastChecked+100; rid++ {
+			if kr.Checked(rid) && !s.MightBeChecked(rid) {
+				t.Fatalf("False negative for round %d (%d).", rid, i)
+			}
+			if rid > kr.lastChecked && s.MightBeChecked(rid) {
+				t.Errorf("Round %d after window reported as checked (%d).",
+					rid, i)
+			}
+		}
+	}
+}
+
+// Tests that the false positive rate of a Summary is close to the expected rate
+// for its size and number of checked rounds.
+func TestKnownRounds_Summary_FalsePositiveRate(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+	kr := NewKnownRound(64 * 1024)
+	kr.Forward(1000)
+	for rid := id.Round(1000); rid < 1000+64*1000; rid++ {
+		if prng.Intn(8) == 0 {
+			kr.Check(rid)
+		}
+	}
+	kr.Check(1000 + 64*1000)
+
+	// 10 bits per checked round has an optimal false positive rate of ~0.8%
+	s := kr.Summary(int(kr.CountChecked()) * 10 / 8)
+
+	var falsePositives, unchecked int
+	for rid := kr.firstUnchecked; rid <= kr.lastChecked; rid++ {
+		if !kr.Checked(rid) {
+			unchecked++
+			if s.MightBeChecked(rid) {
+				falsePositives++
+			}
+		}
+	}
+
+	if rate := float64(falsePositives) / float64(unchecked); rate > 0.02 {
+		t.Errorf("False positive rate %.4f larger than expected.", rate)
+	}
+
+	// The size only depends on the requested size
+	if expected := (int(kr.CountChecked())*10/8 + 7) / 8 * 8; s.Size() != expected {
+		t.Errorf("Unexpected summary size.\nexpected: %d\nreceived: %d",
+			expected, s.Size())
+	}
+}
+
+// Tests that a Summary marshalled via Summary.Marshal and unmarshalled via
+// UnmarshalSummary matches the original.
+func TestSummary_Marshal_UnmarshalSummary(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 20; i++ {
+		s := makeRandomKnownRounds(prng).Summary(prng.Intn(512))
+
+		data := s.Marshal()
+		if len(data) != summaryHeaderLen+s.Size() {
+			t.Errorf("Unexpected marshalled length (%d).\nexpected: %d"+
+				"\nreceived: %d", i, summaryHeaderLen+s.Size(), len(data))
+		}
+
+		received, err := UnmarshalSummary(data)
+		if err != nil {
+			t.Fatalf("UnmarshalSummary returned an error (%d): %+v", i, err)
+		}
+
+		if !reflect.DeepEqual(s, received) {
+			t.Errorf("Unmarshalled summary does not match original (%d)."+
+				"\nexpected: %+v\nreceived: %+v", i, s, received)
+		}
+	}
+}
+
+// Error path: Tests that UnmarshalSummary returns an error wrapping
+// ErrCorruptEncoding for malformed data.
+func TestUnmarshalSummary_CorruptEncoding(t *testing.T) {
+	valid := NewKnownRound(64).Summary(16).Marshal()
+
+	badVersion := append([]byte{}, valid...)
+	badVersion[0] = 1
+	badHashes := append([]byte{}, valid...)
+	badHashes[17] = 0
+	tooManyHashes := append([]byte{}, valid...)
+	tooManyHashes[17] = maxSummaryHashes + 1
+
+	testData := [][]byte{
+		nil,
+		valid[:summaryHeaderLen],
+		valid[:len(valid)-1],
+		badVersion,
+		badHashes,
+		tooManyHashes,
+	}
+
+	for i, data := range testData {
+		_, err := UnmarshalSummary(data)
+		if !errors.Is(err, ErrCorruptEncoding) {
+			t.Errorf("UnmarshalSummary did not return the expected error (%d)."+
+				"\nexpected: %v\nreceived: %+v", i, ErrCorruptEncoding, err)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package knownRounds
+
+import (
+	"context"
+	"sync"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// SyncKnownRounds is a thread-safe wrapper around KnownRounds. Read-only
+// operations take a read lock and operations that modify the bit stream take a
+// write lock.
+//
+// The callbacks passed into the RangeUnchecked and Iterate functions are called
+// while the lock is held and must not call back into the same SyncKnownRounds.
+type SyncKnownRounds struct {
+	kr  *KnownRounds
+	mux sync.RWMutex
+}
+
+// NewSyncKnownRound creates a new empty SyncKnownRounds in the default state
+// with a bit stream that can hold the given number of rounds.
+func NewSyncKnownRound(roundCapacity int) *SyncKnownRounds {
+	return &SyncKnownRounds{kr: NewKnownRound(roundCapacity)}
+}
+
+// NewSyncFromKnownRounds wraps the given KnownRounds in a SyncKnownRounds. The
+// KnownRounds must not be accessed directly after it has been wrapped.
+func NewSyncFromKnownRounds(kr *KnownRounds) *SyncKnownRounds {
+	return &SyncKnownRounds{kr: kr}
+}
+
+// Marshal returns the marshalled KnownRounds. See KnownRounds.Marshal.
+func (s *SyncKnownRounds) Marshal() []byte {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kr.Marshal()
+}
+
+// MarshalWithOptions returns the KnownRounds marshalled with the bit stream
+// encoding selected in the options. See KnownRounds.MarshalWithOptions.
+func (s *SyncKnownRounds) MarshalWithOptions(
+	opts MarshalOptions) ([]byte, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kr.MarshalWithOptions(opts)
+}
+
+// String returns the checked rounds between firstUnchecked and lastChecked as a
+// comma-separated list of rounds and inclusive round ranges. This function
+// satisfies the fmt.Stringer interface. See KnownRounds.String.
+func (s *SyncKnownRounds) String() string {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kr.String()
+}
+
+// MarshalJSON marshals the KnownRounds into a human-readable JSON object. This
+// function adheres to the json.Marshaler interface. See
+// KnownRounds.MarshalJSON.
+func (s *SyncKnownRounds) MarshalJSON() ([]byte, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kr.MarshalJSON()
+}
+
+// UnmarshalJSON unmarshalls the JSON object produced by MarshalJSON into the
+// KnownRounds. This function adheres to the json.Unmarshaler interface. See
+// KnownRounds.UnmarshalJSON.
+func (s *SyncKnownRounds) UnmarshalJSON(data []byte) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.kr.UnmarshalJSON(data)
+}
+
+// Unmarshal parses the data into the KnownRounds. See KnownRounds.Unmarshal.
+func (s *SyncKnownRounds) Unmarshal(data []byte) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.kr.Unmarshal(data)
+}
+
+// OutputBuffChanges returns the changes between the given buffer and the
+// current bit stream. See KnownRounds.OutputBuffChanges.
+func (s *SyncKnownRounds) OutputBuffChanges(
+	old []uint64) (KrChanges, id.Round, id.Round, int, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kr.OutputBuffChanges(old)
+}
+
+// ApplyChanges applies the changes produced by OutputBuffChanges. See
+// KnownRounds.ApplyChanges.
+func (s *SyncKnownRounds) ApplyChanges(changes KrChanges, firstUnchecked,
+	lastChecked id.Round, fuPos int) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.kr.ApplyChanges(changes, firstUnchecked, lastChecked, fuPos)
+}
+
+// GetFirstUnchecked returns the first unchecked round.
+func (s *SyncKnownRounds) GetFirstUnchecked() id.Round {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kr.GetFirstUnchecked()
+}
+
+// GetLastChecked returns the last checked round.
+func (s *SyncKnownRounds) GetLastChecked() id.Round {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kr.GetLastChecked()
+}
+
+// GetFuPos returns the position of the first unchecked round in the bit
+// stream.
+func (s *SyncKnownRounds) GetFuPos() int {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kr.GetFuPos()
+}
+
+// GetBitStream returns a copy of the bit stream.
+func (s *SyncKnownRounds) GetBitStream() []uint64 {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kr.GetBitStream()
+}
+
+// Checked determines if the round has been checked.
+func (s *SyncKnownRounds) Checked(rid id.Round) bool {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kr.Checked(rid)
+}
+
+// Check denotes a round has been checked. See KnownRounds.Check.
+func (s *SyncKnownRounds) Check(rid id.Round) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.kr.Check(rid)
+}
+
+// TryCheck denotes a round has been checked, returning an error instead of
+// panicking if the round is out of scope. See KnownRounds.TryCheck.
+func (s *SyncKnownRounds) TryCheck(rid id.Round) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.kr.TryCheck(rid)
+}
+
+// Uncheck denotes a round as unchecked. See KnownRounds.Uncheck.
+func (s *SyncKnownRounds) Uncheck(rid id.Round) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.kr.Uncheck(rid)
+}
+
+// ResetRange denotes every round from start to end (inclusive) as unchecked.
+// See KnownRounds.ResetRange.
+func (s *SyncKnownRounds) ResetRange(start, end id.Round) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.kr.ResetRange(start, end)
+}
+
+// ForceCheck denotes a round has been checked, shifting the buffer forward if
+// needed. See KnownRounds.ForceCheck.
+func (s *SyncKnownRounds) ForceCheck(rid id.Round) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.kr.ForceCheck(rid)
+}
+
+// Forward sets all rounds before the given round ID as checked.
+func (s *SyncKnownRounds) Forward(rid id.Round) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.kr.Forward(rid)
+}
+
+// RangeUnchecked runs the passed function over all unchecked rounds. See
+// KnownRounds.RangeUnchecked.
+func (s *SyncKnownRounds) RangeUnchecked(oldestUnknown id.Round,
+	threshold uint, roundCheck func(id id.Round) bool, maxPickups int) (
+	earliestRound id.Round, has, unknown []id.Round) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kr.RangeUnchecked(oldestUnknown, threshold, roundCheck, maxPickups)
+}
+
+// RangeUncheckedContext runs the passed function concurrently over all
+// unchecked rounds. It runs on a copy of the KnownRounds taken when it is
+// called, so the lock is not held while waiting on roundCheck and changes made
+// during the call are not seen. See KnownRounds.RangeUncheckedContext.
+func (s *SyncKnownRounds) RangeUncheckedContext(ctx context.Context,
+	oldestUnknown id.Round, threshold uint, roundCheck RoundCheckContextFunc,
+	maxPickups, maxRetries, workers int) (
+	earliestRound id.Round, has, unknown []id.Round, err error) {
+	s.mux.RLock()
+	kr := s.kr.Clone()
+	s.mux.RUnlock()
+	return kr.RangeUncheckedContext(ctx, oldestUnknown, threshold,
+		roundCheck, maxPickups, maxRetries, workers)
+}
+
+// RangeUncheckedMasked masks the bit stream with the provided mask. The mask is
+// modified by this call and must not be accessed concurrently. See
+// KnownRounds.RangeUncheckedMasked.
+func (s *SyncKnownRounds) RangeUncheckedMasked(mask *KnownRounds,
+	roundCheck RoundCheckFunc, maxChecked int) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.kr.RangeUncheckedMasked(mask, roundCheck, maxChecked)
+}
+
+// RangeUncheckedMaskedRange masks the bit stream with the provided mask. The
+// mask is modified by this call and must not be accessed concurrently. See
+// KnownRounds.RangeUncheckedMaskedRange.
+func (s *SyncKnownRounds) RangeUncheckedMaskedRange(mask *KnownRounds,
+	roundCheck RoundCheckFunc, start, end id.Round, maxChecked int) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.kr.RangeUncheckedMaskedRange(mask, roundCheck, start, end, maxChecked)
+}
+
+// CheckMaskedRange checks the rounds indicated by the mask without modifying
+// it and returns the rounds that were checked. The mask must not be modified
+// concurrently. See KnownRounds.CheckMaskedRange.
+func (s *SyncKnownRounds) CheckMaskedRange(mask *KnownRounds,
+	roundCheck RoundCheckFunc, start, end id.Round, maxChecked int) (
+	[]id.Round, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.kr.CheckMaskedRange(mask, roundCheck, start, end, maxChecked)
+}
+
+// Truncate returns a copy of the KnownRounds with firstUnchecked migrated to
+// the given round. Unlike KnownRounds.Truncate, the returned KnownRounds never
+// shares memory with the wrapped KnownRounds.
+func (s *SyncKnownRounds) Truncate(start id.Round) *KnownRounds {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	newKr := s.kr.Truncate(start)
+	if newKr == s.kr {
+		newKr = s.kr.Clone()
+	}
+
+	return newKr
+}
+
+// Len returns the max number of round IDs the buffer can hold.
+func (s *SyncKnownRounds) Len() int {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kr.Len()
+}
+
+// Stats returns statistics on the checked and unchecked rounds in the window.
+// See KnownRounds.Stats.
+func (s *SyncKnownRounds) Stats() Stats {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kr.Stats()
+}
+
+// CountChecked returns the number of checked rounds between firstUnchecked and
+// lastChecked. See KnownRounds.CountChecked.
+func (s *SyncKnownRounds) CountChecked() uint64 {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kr.CountChecked()
+}
+
+// CountUnchecked returns the number of unchecked rounds between firstUnchecked
+// and lastChecked. See KnownRounds.CountUnchecked.
+func (s *SyncKnownRounds) CountUnchecked() uint64 {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kr.CountUnchecked()
+}
+
+// LongestUncheckedGap returns the first round and the length of the longest
+// run of unchecked rounds between firstUnchecked and lastChecked. See
+// KnownRounds.LongestUncheckedGap.
+func (s *SyncKnownRounds) LongestUncheckedGap() (
+	start id.Round, length uint64) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kr.LongestUncheckedGap()
+}
+
+// SetMaxCapacity sets the maximum number of rounds the bit stream can grow to
+// hold. See KnownRounds.SetMaxCapacity.
+func (s *SyncKnownRounds) SetMaxCapacity(maxRoundCapacity int) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.kr.SetMaxCapacity(maxRoundCapacity)
+}
+
+// MaxCapacity returns the maximum number of rounds the bit stream can grow to
+// hold. See KnownRounds.MaxCapacity.
+func (s *SyncKnownRounds) MaxCapacity() int {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kr.MaxCapacity()
+}
+
+// Iterate calls fn for each run of consecutive checked rounds between
+// firstUnchecked and lastChecked, in order. See KnownRounds.Iterate.
+func (s *SyncKnownRounds) Iterate(fn RangeFunc) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	s.kr.Iterate(fn)
+}
+
+// IterateUnchecked calls fn for each run of consecutive unchecked rounds
+// between firstUnchecked and lastChecked, in order. See
+// KnownRounds.IterateUnchecked.
+func (s *SyncKnownRounds) IterateUnchecked(fn RangeFunc) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	s.kr.IterateUnchecked(fn)
+}
+
+// Union returns a new KnownRounds where a round is checked if it is checked in
+// either the wrapped KnownRounds or other. See KnownRounds.Union.
+func (s *SyncKnownRounds) Union(other *KnownRounds) *KnownRounds {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kr.Union(other)
+}
+
+// Intersect returns a new KnownRounds where a round is checked if it is checked
+// in both the wrapped KnownRounds and other. See KnownRounds.Intersect.
+func (s *SyncKnownRounds) Intersect(other *KnownRounds) *KnownRounds {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kr.Intersect(other)
+}
+
+// Difference returns a new KnownRounds where a round is checked if it is
+// checked in the wrapped KnownRounds but not in other. See
+// KnownRounds.Difference.
+func (s *SyncKnownRounds) Difference(other *KnownRounds) *KnownRounds {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kr.Difference(other)
+}
+
+// Slice returns a new KnownRounds containing the check state of the rounds
+// from start to end (inclusive). See KnownRounds.Slice.
+func (s *SyncKnownRounds) Slice(start, end id.Round) (*KnownRounds, error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kr.Slice(start, end)
+}
+
+// Summary returns a Summary of the checked rounds with a filter of the given
+// size in bytes. See KnownRounds.Summary.
+func (s *SyncKnownRounds) Summary(size int) *Summary {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kr.Summary(size)
+}
+
+// Clone returns a deep copy of the wrapped KnownRounds. See KnownRounds.Clone.
+func (s *SyncKnownRounds) Clone() *KnownRounds {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kr.Clone()
+}
+
+// Equal determines if the wrapped KnownRounds and other have the same check
+// state for every round. See KnownRounds.Equal.
+func (s *SyncKnownRounds) Equal(other *KnownRounds) bool {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kr.Equal(other)
+}
+
+// Canonicalize rewrites the wrapped KnownRounds into a canonical form without
+// changing the check state of any round. See KnownRounds.Canonicalize.
+func (s *SyncKnownRounds) Canonicalize() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.kr.Canonicalize()
+}
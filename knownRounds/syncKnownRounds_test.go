@@ -0,0 +1,382 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package knownRounds
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Tests that NewSyncKnownRound wraps a KnownRounds identical to one made with
+// NewKnownRound.
+func TestNewSyncKnownRound(t *testing.T) {
+	expected := NewKnownRound(310)
+	s := NewSyncKnownRound(310)
+
+	if !reflect.DeepEqual(expected, s.kr) {
+		t.Errorf("NewSyncKnownRound did not produce the expected KnownRounds."+
+			"\nexpected: %+v\nreceived: %+v", expected, s.kr)
+	}
+}
+
+// Tests that every SyncKnownRounds operation produces the same result as the
+// same operation on an unwrapped KnownRounds.
+func TestSyncKnownRounds_MatchesKnownRounds(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+	kr := NewKnownRound(640)
+	s := NewSyncKnownRound(640)
+
+	for i := 0; i < 500; i++ {
+		rid := id.Round(prng.Int63n(600) + int64(i))
+		kr.ForceCheck(rid)
+		s.ForceCheck(rid)
+
+		if i%50 == 0 {
+			kr.Forward(rid - 100)
+			s.Forward(rid - 100)
+		}
+
+		if i%7 == 0 {
+			errKr, errS := kr.Uncheck(rid-20), s.Uncheck(rid-20)
+			if (errKr == nil) != (errS == nil) {
+				t.Fatalf("Uncheck error mismatch.\nexpected: %v\nreceived: %v",
+					errKr, errS)
+			}
+		}
+
+		if i%11 == 0 {
+			errKr, errS := kr.ResetRange(rid-30, rid-25), s.ResetRange(rid-30, rid-25)
+			if (errKr == nil) != (errS == nil) {
+				t.Fatalf("ResetRange error mismatch.\nexpected: %v\nreceived: %v",
+					errKr, errS)
+			}
+		}
+	}
+
+	if !bytes.Equal(kr.Marshal(), s.Marshal()) {
+		t.Errorf("Marshalled SyncKnownRounds does not match KnownRounds."+
+			"\nexpected: %v\nreceived: %v", kr.Marshal(), s.Marshal())
+	}
+
+	for _, enc := range []Encoding{EncodingAuto, EncodingBitRun} {
+		krData, errKr := kr.MarshalWithOptions(MarshalOptions{Encoding: enc})
+		sData, errS := s.MarshalWithOptions(MarshalOptions{Encoding: enc})
+		if errKr != nil || errS != nil {
+			t.Fatalf("Failed to marshal with encoding %d: %v, %v",
+				enc, errKr, errS)
+		} else if !bytes.Equal(krData, sData) {
+			t.Errorf("Marshalled SyncKnownRounds with encoding %d does not "+
+				"match KnownRounds.\nexpected: %v\nreceived: %v",
+				enc, krData, sData)
+		}
+	}
+
+	krJSON, errKr := kr.MarshalJSON()
+	sJSON, errS := s.MarshalJSON()
+	if errKr != nil || errS != nil {
+		t.Fatalf("Failed to marshal JSON: %v, %v", errKr, errS)
+	} else if !bytes.Equal(krJSON, sJSON) || kr.String() != s.String() {
+		t.Errorf("JSON of SyncKnownRounds does not match KnownRounds."+
+			"\nexpected: %s\nreceived: %s", krJSON, sJSON)
+	}
+
+	unmarshalled := NewSyncKnownRound(640)
+	if err := unmarshalled.UnmarshalJSON(sJSON); err != nil {
+		t.Fatalf("Failed to unmarshal JSON: %+v", err)
+	} else if !kr.Equal(unmarshalled.kr) {
+		t.Errorf("Unmarshalled SyncKnownRounds does not match KnownRounds."+
+			"\nexpected: %s\nreceived: %s", kr, unmarshalled)
+	}
+
+	for rid := kr.GetFirstUnchecked(); rid <= kr.GetLastChecked(); rid++ {
+		if kr.Checked(rid) != s.Checked(rid) {
+			t.Errorf("Checked(%d) mismatch.\nexpected: %t\nreceived: %t",
+				rid, kr.Checked(rid), s.Checked(rid))
+		}
+	}
+
+	if kr.GetFirstUnchecked() != s.GetFirstUnchecked() ||
+		kr.GetLastChecked() != s.GetLastChecked() ||
+		kr.GetFuPos() != s.GetFuPos() || kr.Len() != s.Len() ||
+		!reflect.DeepEqual(kr.GetBitStream(), s.GetBitStream()) {
+		t.Errorf("SyncKnownRounds state does not match KnownRounds."+
+			"\nexpected: %+v\nreceived: %+v", kr, s.kr)
+	}
+
+	if kr.Stats() != s.Stats() || kr.CountChecked() != s.CountChecked() ||
+		kr.CountUnchecked() != s.CountUnchecked() {
+		t.Errorf("SyncKnownRounds stats do not match KnownRounds."+
+			"\nexpected: %s\nreceived: %s", kr.Stats(), s.Stats())
+	}
+	krStart, krLength := kr.LongestUncheckedGap()
+	sStart, sLength := s.LongestUncheckedGap()
+	if krStart != sStart || krLength != sLength {
+		t.Errorf("LongestUncheckedGap mismatch.\nexpected: %d@%d"+
+			"\nreceived: %d@%d", krLength, krStart, sLength, sStart)
+	}
+
+	s.SetMaxCapacity(1280)
+	kr.SetMaxCapacity(1280)
+	if kr.MaxCapacity() != s.MaxCapacity() {
+		t.Errorf("MaxCapacity mismatch.\nexpected: %d\nreceived: %d",
+			kr.MaxCapacity(), s.MaxCapacity())
+	}
+
+	for _, checked := range []bool{true, false} {
+		var krRuns, sRuns [][2]id.Round
+		collect := func(runs *[][2]id.Round) RangeFunc {
+			return func(start, end id.Round) bool {
+				*runs = append(*runs, [2]id.Round{start, end})
+				return true
+			}
+		}
+		if checked {
+			kr.Iterate(collect(&krRuns))
+			s.Iterate(collect(&sRuns))
+		} else {
+			kr.IterateUnchecked(collect(&krRuns))
+			s.IterateUnchecked(collect(&sRuns))
+		}
+		if !reflect.DeepEqual(krRuns, sRuns) {
+			t.Errorf("Iterated runs (checked %t) mismatch."+
+				"\nexpected: %v\nreceived: %v", checked, krRuns, sRuns)
+		}
+	}
+
+	other := makeRandomKnownRounds(prng)
+	if !kr.Union(other).Equal(s.Union(other)) ||
+		!kr.Intersect(other).Equal(s.Intersect(other)) ||
+		!kr.Difference(other).Equal(s.Difference(other)) {
+		t.Errorf("SyncKnownRounds set operations do not match KnownRounds.")
+	}
+
+	fu, lc := kr.GetFirstUnchecked(), kr.GetLastChecked()
+	krSlice, errKr := kr.Slice(fu+10, lc-10)
+	sSlice, errS := s.Slice(fu+10, lc-10)
+	if errKr != nil || errS != nil {
+		t.Fatalf("Failed to slice: %v, %v", errKr, errS)
+	} else if !reflect.DeepEqual(krSlice, sSlice) {
+		t.Errorf("Slice mismatch.\nexpected: %+v\nreceived: %+v",
+			krSlice, sSlice)
+	}
+
+	if !bytes.Equal(kr.Summary(256).Marshal(), s.Summary(256).Marshal()) {
+		t.Errorf("Summary of SyncKnownRounds does not match KnownRounds.")
+	}
+
+	if !reflect.DeepEqual(kr.Clone(), s.Clone()) || !s.Equal(kr) {
+		t.Errorf("Clone of SyncKnownRounds does not match KnownRounds."+
+			"\nexpected: %+v\nreceived: %+v", kr.Clone(), s.Clone())
+	}
+
+	kr.Canonicalize()
+	s.Canonicalize()
+	if !reflect.DeepEqual(kr, s.kr) {
+		t.Errorf("Canonicalized SyncKnownRounds does not match KnownRounds."+
+			"\nexpected: %+v\nreceived: %+v", kr, s.kr)
+	}
+}
+
+// Tests that the KnownRounds returned by SyncKnownRounds.Truncate does not
+// share memory with the wrapped KnownRounds.
+func TestSyncKnownRounds_Truncate(t *testing.T) {
+	s := NewSyncFromKnownRounds(&KnownRounds{
+		bitStream:      uint64Buff{math.MaxUint64, 0, math.MaxUint64, 0},
+		firstUnchecked: 64,
+		lastChecked:    130,
+		fuPos:          1,
+	})
+
+	newKR := s.Truncate(10)
+	if newKR == s.kr {
+		t.Fatalf("Truncate returned the wrapped KnownRounds.")
+	}
+
+	newKR.Check(127)
+	if s.Checked(127) {
+		t.Errorf("Checking the truncated KnownRounds modified the original.")
+	}
+
+	newKR = s.Truncate(74)
+	if newKR.firstUnchecked != 127 {
+		t.Errorf("Failed to truncate. First unchecked not migrated correctly."+
+			"\nexpected: %d\nreceived: %d", 127, newKR.firstUnchecked)
+	}
+}
+
+// Tests that SyncKnownRounds.Unmarshal and SyncKnownRounds.OutputBuffChanges
+// behave the same as their KnownRounds counterparts.
+func TestSyncKnownRounds_Unmarshal_OutputBuffChanges(t *testing.T) {
+	kr := &KnownRounds{
+		bitStream:      uint64Buff{0, math.MaxUint64, 0, math.MaxUint64, 0},
+		firstUnchecked: 55,
+		lastChecked:    270,
+		fuPos:          55,
+	}
+
+	s := NewSyncFromKnownRounds(&KnownRounds{})
+	if err := s.Unmarshal(kr.Marshal()); err != nil {
+		t.Fatalf("Unmarshal produced an error: %+v", err)
+	}
+
+	if !reflect.DeepEqual(kr, s.kr) {
+		t.Errorf("Unmarshalled SyncKnownRounds does not match original."+
+			"\nexpected: %+v\nreceived: %+v", kr, s.kr)
+	}
+
+	old := s.GetBitStream()
+	s.Check(150)
+	changes, _, _, _, err := s.OutputBuffChanges(old)
+	if err != nil {
+		t.Fatalf("OutputBuffChanges produced an error: %+v", err)
+	}
+	if len(changes) != 1 {
+		t.Errorf("Unexpected number of changes.\nexpected: %d\nreceived: %d",
+			1, len(changes))
+	}
+}
+
+// Tests that SyncKnownRounds.RangeUncheckedContext does not hold the lock while
+// roundCheck runs, so that writers are not blocked by slow lookups.
+func TestSyncKnownRounds_RangeUncheckedContext_Unlocked(t *testing.T) {
+	s := NewSyncKnownRound(128)
+	s.Check(10)
+
+	roundCheck := func(_ context.Context, rid id.Round) (bool, error) {
+		done := make(chan struct{})
+		go func() {
+			s.Check(rid + 50)
+			close(done)
+		}()
+
+		select {
+		case <-done:
+			return true, nil
+		case <-time.After(time.Second):
+			t.Errorf("Check of round %d blocked by RangeUncheckedContext.",
+				rid+50)
+			return false, errors.New("writer blocked")
+		}
+	}
+
+	kr := NewKnownRound(128)
+	kr.Check(10)
+	expected, _, _, _ := kr.RangeUncheckedContext(context.Background(), 0,
+		1000, func(context.Context, id.Round) (bool, error) {
+			return true, nil
+		}, 1000, 0, 1)
+
+	earliest, _, _, err := s.RangeUncheckedContext(
+		context.Background(), 0, 1000, roundCheck, 1000, 0, 1)
+	if err != nil {
+		t.Fatalf("RangeUncheckedContext returned an error: %+v", err)
+	}
+
+	// Rounds checked during the call are not seen by it
+	if earliest != expected {
+		t.Errorf("Unexpected earliest round.\nexpected: %d\nreceived: %d",
+			expected, earliest)
+	}
+}
+
+// Hammers a SyncKnownRounds with concurrent readers and writers. Run with
+// -race to detect unsynchronised access.
+func TestSyncKnownRounds_Concurrent(t *testing.T) {
+	const (
+		writers    = 4
+		readers    = 8
+		iterations = 1000
+	)
+
+	s := NewSyncKnownRound(1024)
+	roundCheck := func(id.Round) bool { return true }
+
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			prng := rand.New(rand.NewSource(int64(w)))
+			for i := 0; i < iterations; i++ {
+				rid := id.Round(i*writers + w)
+				switch prng.Intn(5) {
+				case 0:
+					s.Forward(rid / 2)
+				case 1:
+					s.ForceCheck(rid - rid/8)
+				case 2:
+					s.Canonicalize()
+					s.SetMaxCapacity(1024)
+				default:
+					s.ForceCheck(rid)
+				}
+			}
+		}(w)
+	}
+
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				switch i % 9 {
+				case 0:
+					s.Checked(id.Round(i))
+				case 1:
+					data := s.Marshal()
+					if err := (&KnownRounds{}).Unmarshal(data); err != nil {
+						t.Errorf("Failed to unmarshal data from reader %d: %+v",
+							r, err)
+						return
+					}
+				case 2:
+					s.RangeUnchecked(s.GetFirstUnchecked(), 100, roundCheck, 10)
+				case 3:
+					s.Truncate(s.GetLastChecked()).Check(s.GetLastChecked())
+				case 4:
+					_, _, _, _, _ = s.OutputBuffChanges(s.GetBitStream())
+				case 5:
+					s.Stats()
+					_, _ = s.MarshalWithOptions(MarshalOptions{})
+					_, _ = s.MarshalJSON()
+				case 6:
+					s.Iterate(func(id.Round, id.Round) bool { return true })
+					s.IterateUnchecked(
+						func(id.Round, id.Round) bool { return true })
+				case 7:
+					fu := s.GetFirstUnchecked()
+					_, _ = s.Slice(fu, fu+100)
+					s.Summary(64).MightBeChecked(fu)
+					s.Equal(s.Clone())
+				case 8:
+					other := NewKnownRound(64)
+					s.Union(other)
+					s.Intersect(other)
+					s.Difference(other)
+					s.MaxCapacity()
+				}
+			}
+		}(r)
+	}
+
+	wg.Wait()
+
+	if s.GetFirstUnchecked() > s.GetLastChecked()+1 {
+		t.Errorf("Invalid final state: firstUnchecked %d > lastChecked %d",
+			s.GetFirstUnchecked(), s.GetLastChecked())
+	}
+}
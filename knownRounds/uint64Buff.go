@@ -12,6 +12,7 @@ import (
 	"encoding/binary"
 	"io"
 	"math"
+	"math/bits"
 
 	"github.com/pkg/errors"
 	jww "github.com/spf13/jwalterweatherman"
@@ -135,11 +136,15 @@ func (u64b uint64Buff) extend(numBlocks int) uint64Buff {
 // convertLoc returns the block index and the position of the bit in that block
 // for the given position in the buffer.
 func (u64b uint64Buff) convertLoc(pos int) (int, int) {
-	// Block index in buffer (position / 64)
-	bin := (pos / 64) % len(u64b)
+	// Block index in buffer (position / 64); the modulo is only needed for
+	// positions past the end of the buffer
+	bin := int(uint(pos) / 64)
+	if bin >= len(u64b) {
+		bin %= len(u64b)
+	}
 
 	// Position of bit in block
-	offset := pos % 64
+	offset := int(uint(pos) % 64)
 
 	return bin, offset
 }
@@ -208,14 +213,30 @@ const (
 // changes.
 const currentVersion = 2
 
+// Encoding version of the bit run-length encoding, which stores the lengths of
+// alternating runs of 0 and 1 bits as varints. It can be selected using
+// KnownRounds.MarshalWithOptions but is not written by default so that the
+// data remains readable by older versions.
+const bitRunVersion = 3
+
+// MaxUnmarshalBlocks is the maximum number of uint64 blocks that can be
+// decoded from a marshalled buffer. This prevents a small, malformed run-length
+// encoded buffer from allocating an unbounded amount of memory. Packages that
+// decode their own KnownRounds data should use the same limit.
+const MaxUnmarshalBlocks = 1 << 22
+
 // Map used to select correct unmarshal for the data version.
-var u64bUnmarshalVersion = map[uint8]map[uint8]func(b []byte) (uint64Buff, error){
+var u64bUnmarshalVersion = map[uint8]map[uint8]func(
+	b []byte, maxBlocks int) (uint64Buff, error){
 	currentVersion: {
 		u8bLen:  unmarshal1ByteVer2,
 		u16bLen: unmarshal2BytesVer2,
 		u32bLen: unmarshal4BytesVer2,
 		u64bLen: unmarshal8BytesVer2,
 	},
+	bitRunVersion: {
+		u64bLen: unmarshalBitRunVer3,
+	},
 }
 
 // marshal encodes the buffer into a byte slice and compresses the data using
@@ -233,8 +254,50 @@ func (u64b uint64Buff) marshal() []byte {
 	return append([]byte{currentVersion, u8bLen}, u64b.marshal1ByteVer2()...)
 }
 
-// unmarshal decodes the run-length encoded buffer.
+// marshalEncoding encodes the buffer using the given encoding and prepends the
+// version and word size. If the encoding is EncodingAuto, then every version 2
+// encoding is tried and the smallest result is returned.
+func (u64b uint64Buff) marshalEncoding(encoding Encoding) ([]byte, error) {
+	switch encoding {
+	case EncodingAuto:
+		var smallest []byte
+		for e := Encoding1Byte; e <= Encoding8Bytes; e++ {
+			b, _ := u64b.marshalEncoding(e)
+			if smallest == nil || len(b) < len(smallest) {
+				smallest = b
+			}
+		}
+		return smallest, nil
+	case Encoding1Byte:
+		return append([]byte{currentVersion, u8bLen},
+			u64b.marshal1ByteVer2()...), nil
+	case Encoding2Bytes:
+		return append([]byte{currentVersion, u16bLen},
+			u64b.marshal2BytesVer2()...), nil
+	case Encoding4Bytes:
+		return append([]byte{currentVersion, u32bLen},
+			u64b.marshal4BytesVer2()...), nil
+	case Encoding8Bytes:
+		return append([]byte{currentVersion, u64bLen},
+			u64b.marshal8BytesVer2()...), nil
+	case EncodingBitRun:
+		return append([]byte{bitRunVersion, u64bLen},
+			u64b.marshalBitRunVer3()...), nil
+	default:
+		return nil, errors.Errorf("unrecognized encoding %d", encoding)
+	}
+}
+
+// unmarshal decodes the run-length encoded buffer. An error is returned if the
+// decoded buffer would be larger than MaxUnmarshalBlocks.
 func unmarshal(b []byte) (uint64Buff, error) {
+	return unmarshalLimit(b, MaxUnmarshalBlocks)
+}
+
+// unmarshalLimit decodes the run-length encoded buffer. An error is returned,
+// before the memory is allocated, if the decoded buffer would be larger than
+// maxBlocks.
+func unmarshalLimit(b []byte, maxBlocks int) (uint64Buff, error) {
 	if len(b) < 3 {
 		return nil, errors.Errorf("marshaled bytes length %d smaller than "+
 			"minimum %d", len(b), 3)
@@ -250,7 +313,7 @@ func unmarshal(b []byte) (uint64Buff, error) {
 		return nil, errors.Errorf("encoding word size %d unrecognized", b[1])
 	}
 
-	return unmarshal(b[2:])
+	return unmarshal(b[2:], maxBlocks)
 }
 
 func (u64b uint64Buff) marshal1ByteVer2() []byte {
@@ -306,7 +369,7 @@ func (u64b uint64Buff) marshal1ByteVer2() []byte {
 	return buf.Bytes()
 }
 
-func unmarshal1ByteVer2(b []byte) (uint64Buff, error) {
+func unmarshal1ByteVer2(b []byte, maxBlocks int) (uint64Buff, error) {
 	buf := bytes.NewBuffer(b)
 	var u8b []uint8
 	var err error
@@ -317,13 +380,20 @@ func unmarshal1ByteVer2(b []byte) (uint64Buff, error) {
 		if num == 0 || num == 0xFF {
 			run, err := buf.ReadByte()
 			if err != nil {
-				jww.FATAL.Panicf("Failed to read next byte: %+v", err)
+				return nil, errors.Errorf("failed to read run length for "+
+					"value %d: %+v", num, err)
+			} else if len(u8b)+int(run) > maxBlocks*8 {
+				return nil, errors.Errorf("uncompressed data exceeds maximum "+
+					"of %d blocks", maxBlocks)
 			}
 			runBuf := make([]uint8, run)
 			for i := range runBuf {
 				runBuf[i] = num
 			}
 			u8b = append(u8b, runBuf...)
+		} else if len(u8b)+1 > maxBlocks*8 {
+			return nil, errors.Errorf("uncompressed data exceeds maximum of "+
+				"%d blocks", maxBlocks)
 		} else {
 			u8b = append(u8b, num)
 		}
@@ -411,7 +481,7 @@ func (u64b uint64Buff) marshal2BytesVer2() []byte {
 	return buf.Bytes()
 }
 
-func unmarshal2BytesVer2(b []byte) (uint64Buff, error) {
+func unmarshal2BytesVer2(b []byte, maxBlocks int) (uint64Buff, error) {
 	buf := bytes.NewBuffer(b)
 	var u16b []uint16
 
@@ -420,12 +490,24 @@ func unmarshal2BytesVer2(b []byte) (uint64Buff, error) {
 	for ; len(bb) == u16bLen; bb = buf.Next(u16bLen) {
 		num := binary.BigEndian.Uint16(bb)
 		if num == 0 || num == math.MaxUint16 {
-			run := binary.BigEndian.Uint16(buf.Next(u16bLen))
+			bb = buf.Next(u16bLen)
+			if len(bb) != u16bLen {
+				return nil, errors.Errorf("failed to read run length for "+
+					"value %d", num)
+			}
+			run := binary.BigEndian.Uint16(bb)
+			if len(u16b)+int(run) > maxBlocks*4 {
+				return nil, errors.Errorf("uncompressed data exceeds maximum "+
+					"of %d blocks", maxBlocks)
+			}
 			runBuf := make([]uint16, run)
 			for i := range runBuf {
 				runBuf[i] = num
 			}
 			u16b = append(u16b, runBuf...)
+		} else if len(u16b)+1 > maxBlocks*4 {
+			return nil, errors.Errorf("uncompressed data exceeds maximum of "+
+				"%d blocks", maxBlocks)
 		} else {
 			u16b = append(u16b, num)
 		}
@@ -505,7 +587,7 @@ func (u64b uint64Buff) marshal4BytesVer2() []byte {
 	return buf.Bytes()
 }
 
-func unmarshal4BytesVer2(b []byte) (uint64Buff, error) {
+func unmarshal4BytesVer2(b []byte, maxBlocks int) (uint64Buff, error) {
 	buf := bytes.NewBuffer(b)
 	var u32b []uint32
 
@@ -514,12 +596,24 @@ func unmarshal4BytesVer2(b []byte) (uint64Buff, error) {
 	for ; len(bb) == u32bLen; bb = buf.Next(u32bLen) {
 		num := binary.BigEndian.Uint32(bb)
 		if num == 0 || num == math.MaxUint32 {
-			run := binary.BigEndian.Uint32(buf.Next(u32bLen))
+			bb = buf.Next(u32bLen)
+			if len(bb) != u32bLen {
+				return nil, errors.Errorf("failed to read run length for "+
+					"value %d", num)
+			}
+			run := binary.BigEndian.Uint32(bb)
+			if uint64(len(u32b))+uint64(run) > uint64(maxBlocks)*2 {
+				return nil, errors.Errorf("uncompressed data exceeds maximum "+
+					"of %d blocks", maxBlocks)
+			}
 			runBuf := make([]uint32, run)
 			for i := range runBuf {
 				runBuf[i] = num
 			}
 			u32b = append(u32b, runBuf...)
+		} else if len(u32b)+1 > maxBlocks*2 {
+			return nil, errors.Errorf("uncompressed data exceeds maximum of "+
+				"%d blocks", maxBlocks)
 		} else {
 			u32b = append(u32b, num)
 		}
@@ -589,7 +683,7 @@ func (u64b uint64Buff) marshal8BytesVer2() []byte {
 	return buf.Bytes()
 }
 
-func unmarshal8BytesVer2(b []byte) (uint64Buff, error) {
+func unmarshal8BytesVer2(b []byte, maxBlocks int) (uint64Buff, error) {
 	buf := bytes.NewBuffer(b)
 	buff := uint64Buff{}
 
@@ -602,11 +696,19 @@ func unmarshal8BytesVer2(b []byte) (uint64Buff, error) {
 				return nil, errors.New("failed to get run")
 			}
 			run := binary.LittleEndian.Uint64(bb)
+			if run > uint64(maxBlocks) ||
+				uint64(len(buff))+run > uint64(maxBlocks) {
+				return nil, errors.Errorf("uncompressed data exceeds maximum "+
+					"of %d blocks", maxBlocks)
+			}
 			runBuf := make(uint64Buff, run)
 			for i := range runBuf {
 				runBuf[i] = num
 			}
 			buff = append(buff, runBuf...)
+		} else if len(buff)+1 > maxBlocks {
+			return nil, errors.Errorf("uncompressed data exceeds maximum of "+
+				"%d blocks", maxBlocks)
 		} else {
 			buff = append(buff, num)
 		}
@@ -619,3 +721,100 @@ func unmarshal8BytesVer2(b []byte) (uint64Buff, error) {
 
 	return buff, nil
 }
+
+// marshalBitRunVer3 encodes the buffer as the number of blocks followed by the
+// lengths of alternating runs of 0 and 1 bits, starting with a run of 0 bits.
+// The first run may have a length of zero; every other run is at least one bit
+// long. All values are written as uvarints.
+func (u64b uint64Buff) marshalBitRunVer3() []byte {
+	b := make([]byte, binary.MaxVarintLen64)
+	var buf bytes.Buffer
+	buf.Write(b[:binary.PutUvarint(b, uint64(len(u64b)))])
+
+	var run uint64
+	setBits := false
+	for _, word := range u64b {
+		for pos := 0; pos < 64; {
+			// Count the bits from pos that match the current run
+			w := word << uint(pos)
+			if setBits {
+				w = ^w
+			}
+			n := bits.LeadingZeros64(w)
+			if n > 64-pos {
+				n = 64 - pos
+			}
+
+			run += uint64(n)
+			pos += n
+
+			// The run ended before the end of the word
+			if pos < 64 {
+				buf.Write(b[:binary.PutUvarint(b, run)])
+				run = 0
+				setBits = !setBits
+			}
+		}
+	}
+
+	if len(u64b) > 0 {
+		buf.Write(b[:binary.PutUvarint(b, run)])
+	}
+
+	return buf.Bytes()
+}
+
+func unmarshalBitRunVer3(b []byte, maxBlocks int) (uint64Buff, error) {
+	buf := bytes.NewReader(b)
+
+	numBlocks, err := binary.ReadUvarint(buf)
+	if err != nil {
+		return nil, errors.Errorf("failed to read number of blocks: %+v", err)
+	} else if numBlocks > uint64(maxBlocks) {
+		return nil, errors.Errorf("number of blocks %d exceeds maximum of %d",
+			numBlocks, maxBlocks)
+	}
+
+	u64b := make(uint64Buff, numBlocks)
+	total := numBlocks * 64
+
+	var pos uint64
+	for n, setBits := 0, false; pos < total; n, setBits = n+1, !setBits {
+		run, err := binary.ReadUvarint(buf)
+		if err != nil {
+			return nil, errors.Errorf("failed to read run %d: %+v", n, err)
+		} else if run == 0 && n > 0 {
+			return nil, errors.Errorf("run %d has a length of zero", n)
+		} else if run > total-pos {
+			return nil, errors.Errorf("run %d of length %d exceeds the %d "+
+				"remaining bits", n, run, total-pos)
+		}
+
+		if setBits {
+			u64b.setRange(int(pos), int(pos+run))
+		}
+		pos += run
+	}
+
+	if buf.Len() != 0 {
+		return nil, errors.Errorf("extraneous data of length %d found at end "+
+			"of buffer", buf.Len())
+	}
+
+	return u64b, nil
+}
+
+// setRange sets all the bits in the buffer from start to end (excluding the
+// end bit). Unlike clearRange, the range does not wrap around the buffer.
+func (u64b uint64Buff) setRange(start, end int) {
+	for pos := start; pos < end; {
+		bin, offset := pos/64, pos%64
+		n := 64 - offset
+		if end-pos < n {
+			n = end - pos
+		}
+
+		u64b[bin] |= ^bitMaskRange(offset, offset+n)
+		pos += n
+	}
+}
@@ -425,7 +425,7 @@ func TestUint64Buff_marshal_unmarshal_Bytes(t *testing.T) {
 	for i, data := range testData {
 
 		buff := data.marshal1ByteVer2()
-		u64b, err := unmarshal1ByteVer2(buff)
+		u64b, err := unmarshal1ByteVer2(buff, MaxUnmarshalBlocks)
 		if err != nil {
 			t.Errorf("unmarshal1ByteVer2 returned an error: %+v", err)
 		}
@@ -436,7 +436,7 @@ func TestUint64Buff_marshal_unmarshal_Bytes(t *testing.T) {
 		}
 
 		buff = data.marshal2BytesVer2()
-		u64b, err = unmarshal2BytesVer2(buff)
+		u64b, err = unmarshal2BytesVer2(buff, MaxUnmarshalBlocks)
 		if err != nil {
 			t.Errorf("unmarshal2BytesVer2 returned an error: %+v", err)
 		}
@@ -447,7 +447,7 @@ func TestUint64Buff_marshal_unmarshal_Bytes(t *testing.T) {
 		}
 
 		buff = data.marshal4BytesVer2()
-		u64b, err = unmarshal4BytesVer2(buff)
+		u64b, err = unmarshal4BytesVer2(buff, MaxUnmarshalBlocks)
 		if err != nil {
 			t.Errorf("unmarshal4BytesVer2 returned an error: %+v", err)
 		}
@@ -458,7 +458,7 @@ func TestUint64Buff_marshal_unmarshal_Bytes(t *testing.T) {
 		}
 
 		buff = data.marshal8BytesVer2()
-		u64b, err = unmarshal8BytesVer2(buff)
+		u64b, err = unmarshal8BytesVer2(buff, MaxUnmarshalBlocks)
 		if err != nil {
 			t.Errorf("unmarshal8BytesVer2 returned an error: %+v", err)
 		}
@@ -631,6 +631,189 @@ func TestUint64Buff_marshal_unmarshal_Bytes(t *testing.T) {
 // 	}
 // }
 
+// Tests that a buffer encoded with each Encoding is decoded to the original
+// buffer by unmarshal.
+func TestUint64Buff_marshalEncoding_unmarshal(t *testing.T) {
+	testData := []uint64Buff{
+		{},
+		{0},
+		{1},
+		{ones},
+		{0x7FFFFFFFFFFFFFFF},
+		{0, ones, 0, ones, 0},
+		{0xAAAAAAAAAAAAAAAA, 0x5555555555555555},
+		{0x7FFFFFFFFFFFFFFF, ones, ones, ones, ones, 0x13374AFB434FF, 0, 0, 0xFFFFFF00F0000000},
+		initU64B(0, math.MaxUint8*2),
+		initU64B(math.MaxUint64, math.MaxUint8*2),
+	}
+
+	for i, data := range testData {
+		for e := EncodingAuto; e <= EncodingBitRun; e++ {
+			b, err := data.marshalEncoding(e)
+			if err != nil {
+				t.Fatalf("marshalEncoding returned an error for encoding %d "+
+					"(%d): %+v", e, i, err)
+			}
+
+			// Empty buffers are not valid version 2 data
+			if len(data) == 0 && e != EncodingBitRun {
+				continue
+			}
+
+			u64b, err := unmarshal(b)
+			if err != nil {
+				t.Errorf("unmarshal returned an error for encoding %d (%d): "+
+					"%+v", e, i, err)
+			}
+
+			if len(data) != len(u64b) || (len(data) > 0 &&
+				!reflect.DeepEqual(data, u64b)) {
+				t.Errorf("Failed to marshal and unmarshal with encoding %d "+
+					"(%d).\nexpected: %X\nreceived: %X", e, i, data, u64b)
+			}
+		}
+	}
+}
+
+// Tests that EncodingAuto produces output no larger than any version 2
+// encoding and never selects the version 3 encoding.
+func TestUint64Buff_marshalEncoding_Auto(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+	testData := []uint64Buff{
+		{0, ones, 0, ones, 0},
+		{0xAAAAAAAAAAAAAAAA, 0x5555555555555555},
+		initU64B(0, 1000),
+		makeRandomUint64Slice(20, prng),
+	}
+
+	for i, data := range testData {
+		auto, _ := data.marshalEncoding(EncodingAuto)
+		if auto[0] != currentVersion {
+			t.Errorf("EncodingAuto selected encoding version %d (%d).",
+				auto[0], i)
+		}
+		for e := Encoding1Byte; e <= Encoding8Bytes; e++ {
+			b, _ := data.marshalEncoding(e)
+			if len(auto) > len(b) {
+				t.Errorf("EncodingAuto output of length %d larger than "+
+					"encoding %d of length %d (%d).", len(auto), e, len(b), i)
+			}
+		}
+	}
+}
+
+// Tests that the bit run encoding of a buffer with long runs is smaller than
+// the version 2 encodings.
+func TestUint64Buff_marshalBitRunVer3_Size(t *testing.T) {
+	data := append(initU64B(0, 1000), 0x8000000000000000, 0)
+	bitRun, _ := data.marshalEncoding(EncodingBitRun)
+
+	for e := Encoding1Byte; e <= Encoding8Bytes; e++ {
+		b, _ := data.marshalEncoding(e)
+		if len(bitRun) >= len(b) {
+			t.Errorf("Bit run encoding of length %d not smaller than encoding "+
+				"%d of length %d.", len(bitRun), e, len(b))
+		}
+	}
+}
+
+// Error path: tests that unmarshalBitRunVer3 returns an error for malformed
+// data.
+func Test_unmarshalBitRunVer3_Error(t *testing.T) {
+	testData := [][]byte{
+		{},
+		{0x80},
+		{1},
+		{1, 64, 0},
+		{1, 0, 0},
+		{1, 10, 60},
+		{1, 10, 54, 1},
+		{0xFF, 0xFF, 0xFF, 0xFF, 0x0F},
+	}
+
+	for i, data := range testData {
+		_, err := unmarshalBitRunVer3(data, MaxUnmarshalBlocks)
+		if err == nil {
+			t.Errorf("unmarshalBitRunVer3 did not return an error (%d): %v",
+				i, data)
+		}
+	}
+}
+
+// Tests that an invalid Encoding returns an error.
+func TestUint64Buff_marshalEncoding_InvalidEncodingError(t *testing.T) {
+	if _, err := (uint64Buff{1}).marshalEncoding(EncodingBitRun + 1); err == nil {
+		t.Errorf("marshalEncoding did not return an error for an invalid " +
+			"encoding.")
+	}
+}
+
+// Tests that unmarshal returns an error instead of panicking on run-length
+// encoded data whose run length is truncated.
+func Test_unmarshal_TruncatedRun(t *testing.T) {
+	testData := [][]byte{
+		{currentVersion, u8bLen, 0},
+		{currentVersion, u8bLen, 255, 8, 255},
+		{currentVersion, u16bLen, 0, 0},
+		{currentVersion, u16bLen, 0, 0, 0},
+		{currentVersion, u32bLen, 255, 255, 255, 255},
+		{currentVersion, u32bLen, 255, 255, 255, 255, 0, 0},
+		{currentVersion, u64bLen, 0, 0, 0, 0, 0, 0, 0, 0},
+	}
+
+	for i, data := range testData {
+		if _, err := unmarshal(data); err == nil {
+			t.Errorf("unmarshal did not return an error for truncated data "+
+				"(%d): %v", i, data)
+		}
+	}
+}
+
+// Tests that unmarshal returns an error for run lengths that decode to more
+// than MaxUnmarshalBlocks.
+func Test_unmarshal_MaxBlocks(t *testing.T) {
+	testData := [][]byte{
+		{currentVersion, u32bLen, 0, 0, 0, 0, 255, 255, 255, 255},
+		{currentVersion, u64bLen, 0, 0, 0, 0, 0, 0, 0, 0,
+			255, 255, 255, 255, 255, 255, 255, 255},
+	}
+
+	for i, data := range testData {
+		if _, err := unmarshal(data); err == nil {
+			t.Errorf("unmarshal did not return an error for data larger "+
+				"than the maximum (%d): %v", i, data)
+		}
+	}
+}
+
+// Tests that no input to unmarshal causes a panic and that successfully
+// unmarshalled buffers can be marshalled again.
+func Fuzz_unmarshal(f *testing.F) {
+	data := uint64Buff{0xFFFFFF00F0000000, 0, 0, ones, 0x13374AFB434FF}
+	f.Add(append([]byte{currentVersion, u8bLen}, data.marshal1ByteVer2()...))
+	f.Add(append([]byte{currentVersion, u16bLen}, data.marshal2BytesVer2()...))
+	f.Add(append([]byte{currentVersion, u32bLen}, data.marshal4BytesVer2()...))
+	f.Add(append([]byte{currentVersion, u64bLen}, data.marshal8BytesVer2()...))
+	f.Add(append([]byte{bitRunVersion, u64bLen}, data.marshalBitRunVer3()...))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		u64b, err := unmarshal(data)
+		if err != nil {
+			return
+		}
+
+		u64b2, err := unmarshal(u64b.marshal())
+		if err != nil {
+			t.Fatalf("Failed to unmarshal remarshalled data: %+v", err)
+		}
+
+		if len(u64b) != len(u64b2) {
+			t.Errorf("Remarshalled buffer has incorrect length."+
+				"\nexpected: %d\nreceived: %d", len(u64b), len(u64b2))
+		}
+	})
+}
+
 // printBuff prints the buffer and mask in binary with their start and end point
 // labeled.
 func printBuff(
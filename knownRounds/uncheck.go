@@ -0,0 +1,96 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package knownRounds
+
+import (
+	"github.com/pkg/errors"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Uncheck denotes a round as unchecked, reverting a previous call to Check. If
+// the round is before firstUnchecked, then firstUnchecked is moved back to it
+// and every round between them remains checked. An error wrapping
+// ErrOutOfScope is returned if the buffer is not large enough to hold every
+// round from rid to lastChecked; in that case, kr is not modified.
+func (kr *KnownRounds) Uncheck(rid id.Round) error {
+	return kr.ResetRange(rid, rid)
+}
+
+// ResetRange denotes every round from start to end (inclusive) as unchecked.
+// If start is before firstUnchecked, then firstUnchecked is moved back to start
+// and every round between end and the old firstUnchecked remains checked. An
+// error is returned if end is before start. An error wrapping ErrOutOfScope is
+// returned if the buffer is not large enough to hold every round from start to
+// lastChecked; in that case, kr is not modified.
+func (kr *KnownRounds) ResetRange(start, end id.Round) error {
+	if end < start {
+		return errors.Errorf(
+			"end round %d is before start round %d", end, start)
+	}
+
+	// Every round before firstUnchecked is checked. After Truncate,
+	// firstUnchecked can be more than one after lastChecked, so the last
+	// checked round is the later of lastChecked and firstUnchecked-1. Rounds
+	// after it are already unchecked.
+	last := kr.lastChecked
+	if kr.firstUnchecked > 0 && kr.firstUnchecked-1 > last {
+		last = kr.firstUnchecked - 1
+	}
+	if start > last {
+		return nil
+	} else if end > last {
+		end = last
+	}
+
+	if start < kr.firstUnchecked {
+		if uint64(last-start) >= uint64(kr.Len()) {
+			return errors.Wrapf(ErrOutOfScope, "cannot uncheck round %d "+
+				"with last checked round %d and buffer size %d",
+				start, last, kr.Len())
+		}
+
+		// The positions before fuPos may hold stale data; mark every round
+		// between start and firstUnchecked as checked before moving back.
+		// Rounds between lastChecked and the old firstUnchecked are checked,
+		// so lastChecked moves up to cover them.
+		kr.writeRange(start, int(kr.firstUnchecked-start), true)
+		kr.fuPos = kr.getBitStreamPos(start)
+		kr.firstUnchecked = start
+		kr.lastChecked = last
+	} else if kr.Len() == 0 {
+		return nil
+	}
+
+	kr.writeRange(start, int(end-start)+1, false)
+
+	return nil
+}
+
+// writeRange sets the bits for the n rounds starting at start to the given
+// value. The rounds must all fit in the buffer.
+func (kr *KnownRounds) writeRange(start id.Round, n int, value bool) {
+	pos := kr.getBitStreamPos(start)
+	for n > 0 {
+		bin, offset := pos/64, pos%64
+		count := 64 - offset
+		if n < count {
+			count = n
+		}
+
+		mask := ^bitMaskRange(offset, offset+count)
+		if value {
+			kr.bitStream[bin] |= mask
+		} else {
+			kr.bitStream[bin] &^= mask
+		}
+
+		n -= count
+		pos = (pos + count) % kr.Len()
+	}
+}
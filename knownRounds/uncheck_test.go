@@ -0,0 +1,204 @@
+////////////////////////////////////////////////////////////////////////////////
+// Copyright © 2024 xx foundation                                             //
+//                                                                            //
+// Use of this source code is governed by a license that can be found in the  //
+// LICENSE file.                                                              //
+////////////////////////////////////////////////////////////////////////////////
+
+package knownRounds
+
+import (
+	"errors"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"gitlab.com/xx_network/primitives/id"
+)
+
+// Tests that KnownRounds.Uncheck reverts a call to KnownRounds.Check for rounds
+// inside the window, before firstUnchecked, and after lastChecked.
+func TestKnownRounds_Uncheck(t *testing.T) {
+	kr := NewKnownRound(128)
+	for _, rid := range []id.Round{0, 1, 2, 3, 5, 6, 9} {
+		kr.Check(rid)
+	}
+
+	// Inside the window
+	if err := kr.Uncheck(6); err != nil {
+		t.Fatalf("Uncheck returned an error: %+v", err)
+	}
+	if kr.Checked(6) || !kr.Checked(5) || !kr.Checked(9) {
+		t.Errorf("Uncheck of round 6 changed the wrong rounds: %+v", kr)
+	}
+
+	// Before firstUnchecked
+	if err := kr.Uncheck(1); err != nil {
+		t.Fatalf("Uncheck returned an error: %+v", err)
+	}
+	if kr.firstUnchecked != 1 {
+		t.Errorf("firstUnchecked not moved back.\nexpected: %d\nreceived: %d",
+			1, kr.firstUnchecked)
+	}
+	expected := map[id.Round]bool{0: true, 1: false, 2: true, 3: true,
+		4: false, 5: true, 6: false, 9: true, 10: false}
+	for rid, checked := range expected {
+		if kr.Checked(rid) != checked {
+			t.Errorf("Round %d has incorrect state.\nexpected: %t"+
+				"\nreceived: %t", rid, checked, kr.Checked(rid))
+		}
+	}
+
+	// After lastChecked
+	before := kr.GetBitStream()
+	if err := kr.Uncheck(500); err != nil {
+		t.Fatalf("Uncheck returned an error: %+v", err)
+	}
+	if !reflect.DeepEqual(before, kr.GetBitStream()) || kr.lastChecked != 9 {
+		t.Errorf("Uncheck of round after lastChecked modified kr: %+v", kr)
+	}
+
+	// Checking the round again restores firstUnchecked
+	kr.Check(1)
+	if kr.firstUnchecked != 4 {
+		t.Errorf("firstUnchecked not restored.\nexpected: %d\nreceived: %d",
+			4, kr.firstUnchecked)
+	}
+}
+
+// Tests that KnownRounds.ResetRange produces the expected check state for
+// random ranges on random KnownRounds, including ranges that wrap around the
+// end of the buffer and move firstUnchecked back.
+func TestKnownRounds_ResetRange(t *testing.T) {
+	prng := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 500; i++ {
+		kr := makeRandomKnownRounds(prng)
+		oldFu, oldLc := kr.firstUnchecked, kr.lastChecked
+		start := oldFu + id.Round(prng.Intn(kr.Len()))
+		if start > id.Round(kr.Len()/2) {
+			start -= id.Round(prng.Intn(kr.Len() / 2))
+		}
+		end := start + id.Round(prng.Intn(kr.Len()))
+
+		low := id.Round(0)
+		if start > id.Round(kr.Len()) {
+			low = start - id.Round(kr.Len())
+		}
+		high := oldLc + id.Round(kr.Len())
+		expected := make(map[id.Round]bool)
+		for rid := low; rid <= high; rid++ {
+			expected[rid] = kr.Checked(rid) && (rid < start || rid > end)
+		}
+
+		err := kr.ResetRange(start, end)
+		if errors.Is(err, ErrOutOfScope) {
+			if uint64(oldLc-start) < uint64(kr.Len()) {
+				t.Errorf("ResetRange returned an out of scope error for a "+
+					"range that fits (%d): %+v", i, err)
+			}
+			continue
+		} else if err != nil {
+			t.Fatalf("ResetRange returned an error (%d): %+v", i, err)
+		}
+
+		for rid := low; rid <= high; rid++ {
+			if kr.Checked(rid) != expected[rid] {
+				t.Fatalf("Round %d has incorrect state after resetting "+
+					"[%d, %d] (%d).\nexpected: %t\nreceived: %t\nkr: %+v",
+					rid, start, end, i, expected[rid], kr.Checked(rid), kr)
+			}
+		}
+
+		if kr.fuPos%64 != int(kr.firstUnchecked%64) {
+			t.Errorf("fuPos %d does not match firstUnchecked %d (%d).",
+				kr.fuPos, kr.firstUnchecked, i)
+		}
+
+		if kr.firstUnchecked <= kr.lastChecked && kr.Checked(kr.firstUnchecked) {
+			t.Errorf("firstUnchecked %d is checked (%d).",
+				kr.firstUnchecked, i)
+		}
+
+		// The state must survive a marshal round trip
+		newKr := &KnownRounds{}
+		if err = newKr.Unmarshal(kr.Marshal()); err != nil {
+			t.Fatalf("Failed to unmarshal (%d): %+v", i, err)
+		}
+		for rid := low; rid <= high; rid++ {
+			if newKr.Checked(rid) != expected[rid] {
+				t.Fatalf("Round %d has incorrect state after marshal round "+
+					"trip (%d).\nexpected: %t\nreceived: %t",
+					rid, i, expected[rid], newKr.Checked(rid))
+			}
+		}
+	}
+}
+
+// Tests that KnownRounds.ResetRange on a KnownRounds returned by Truncate,
+// where firstUnchecked is more than one after lastChecked, only unchecks the
+// requested rounds and keeps the rounds between lastChecked and
+// firstUnchecked checked.
+func TestKnownRounds_ResetRange_Truncated(t *testing.T) {
+	tests := []struct{ start, end id.Round }{
+		{5, 8},
+		{20, 30},
+		{8, 49},
+		{40, 100},
+		{50, 60},
+		{0, 0},
+	}
+
+	for i, tt := range tests {
+		kr := NewKnownRound(256)
+		kr.Check(5)
+		kr.Check(10)
+		kr = kr.Truncate(50)
+
+		if err := kr.ResetRange(tt.start, tt.end); err != nil {
+			t.Fatalf("ResetRange returned an error (%d): %+v", i, err)
+		}
+
+		for rid := id.Round(0); rid < 300; rid++ {
+			expected := rid < 50 && (rid < tt.start || rid > tt.end)
+			if kr.Checked(rid) != expected {
+				t.Errorf("Round %d has incorrect state after resetting "+
+					"[%d, %d] (%d).\nexpected: %t\nreceived: %t",
+					rid, tt.start, tt.end, i, expected, kr.Checked(rid))
+			}
+		}
+	}
+}
+
+// Error path: Tests that KnownRounds.ResetRange returns an error when end is
+// before start.
+func TestKnownRounds_ResetRange_InvalidRangeError(t *testing.T) {
+	kr := NewKnownRound(64)
+	kr.Check(5)
+
+	if err := kr.ResetRange(5, 4); err == nil {
+		t.Error("ResetRange did not return an error for an invalid range.")
+	}
+}
+
+// Error path: Tests that KnownRounds.Uncheck returns an error wrapping
+// ErrOutOfScope when the round is too old to fit in the buffer and that kr is
+// not modified.
+func TestKnownRounds_Uncheck_OutOfScopeError(t *testing.T) {
+	kr := NewKnownRound(64)
+	kr.Forward(100)
+	kr.Check(120)
+	expected := NewFromParts(kr.GetBitStream(), kr.firstUnchecked, kr.lastChecked,
+		kr.fuPos)
+
+	err := kr.Uncheck(120 - 64)
+	if !errors.Is(err, ErrOutOfScope) {
+		t.Errorf("Uncheck did not return the expected error."+
+			"\nexpected: %v\nreceived: %+v", ErrOutOfScope, err)
+	}
+
+	if !reflect.DeepEqual(expected, kr) {
+		t.Errorf("Uncheck modified kr on error.\nexpected: %+v\nreceived: %+v",
+			expected, kr)
+	}
+}